@@ -1,13 +1,12 @@
 module github.com/pantheon-systems/go-demo-service
 
 require (
-	github.com/fsnotify/fsnotify v1.4.9 // indirect
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/magiconair/properties v1.8.4 // indirect
 	github.com/mitchellh/mapstructure v1.3.3 // indirect
 	github.com/pantheon-systems/certinel v1.2.1
 	github.com/pantheon-systems/go-certauth v0.0.0-20170606170341-8764720d23a5
-	github.com/pantheon-systems/go-metrics-graphite v0.0.0-20160728174909-d377c3b32efb
 	github.com/pelletier/go-toml v1.8.1 // indirect
 	github.com/pkg/errors v0.9.1
 	github.com/rcrowley/go-metrics v0.0.0-20200313005456-10cdbea86bc0
@@ -18,8 +17,11 @@ require (
 	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/spf13/viper v1.7.1
 	github.com/streadway/handy v0.0.0-20200128134331-0f66f006fb2e
+	go.opentelemetry.io/otel v1.2.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.2.0
+	go.opentelemetry.io/otel/sdk v1.2.0
+	go.opentelemetry.io/otel/trace v1.2.0
 	go.uber.org/automaxprocs v1.3.0
-	golang.org/x/sys v0.0.0-20201109165425-215b40eba54c // indirect
 	gopkg.in/ini.v1 v1.61.0 // indirect
 	gopkg.in/yaml.v2 v2.3.0 // indirect
 )
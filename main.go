@@ -8,31 +8,43 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	// TODO: retire uber/automaxprocs when the behavior becomes part of Go's stdlib
 	// tracking: https://github.com/uber-go/automaxprocs/issues/21#issuecomment-571707692
 	// tracking: https://github.com/golang/go/issues/33803
 	_ "go.uber.org/automaxprocs"
 
-	"github.com/pantheon-systems/certinel"
-	certauth "github.com/pantheon-systems/go-certauth"
-	"github.com/pantheon-systems/go-certauth/certutils"
 	"github.com/pantheon-systems/go-demo-service/pkg/app"
 	"github.com/pantheon-systems/go-demo-service/pkg/appmetrics"
 	"github.com/pantheon-systems/go-demo-service/pkg/certwatcher"
 	"github.com/pantheon-systems/go-demo-service/pkg/healthz"
 	"github.com/pantheon-systems/go-demo-service/pkg/server"
+	"github.com/pantheon-systems/go-demo-service/pkg/tracing"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
 const (
 	appName = "go-demo-service"
+	// metricsShutdownTimeout bounds the last flush of the metrics sinks, a
+	// Graphite flush may take up to 10s to connect and 10s to write.
+	metricsShutdownTimeout = 20 * time.Second
 )
 
+// version is set at build time with `-ldflags "-X main.version=..."`.
+var version = "dev"
+
 func initConfig() error {
-	viper.SetDefault("debug", true)
+	viper.SetDefault("debug", false)
 	viper.SetDefault("port-healthz", 8080)
+	viper.SetDefault("port-debug", 6060)
+	viper.SetDefault("tracing-sample-ratio", 1.0)
+	viper.SetDefault("cert-reload-max-failures", 5)
+	viper.SetDefault("cert-watch-mode", certwatcher.ModePoll)
+	viper.SetDefault("cert-poll-interval", 60*time.Second)
+	viper.SetDefault("cert-expiry-threshold", 14*24*time.Hour)
+	viper.SetDefault("cert-expiry-check-interval", time.Hour)
 
 	viper.SetConfigName(appName)
 	viper.AddConfigPath(".")
@@ -53,6 +65,8 @@ func initLog() {
 		log.SetLevel(log.DebugLevel)
 	}
 	log.SetOutput(os.Stdout)
+	// Adds the trace and span IDs to the entries logged WithContext.
+	log.AddHook(tracing.LogHook{})
 	if viper.GetBool("log-fmt-json") {
 		log.SetFormatter(&log.JSONFormatter{
 			TimestampFormat: "2006-01-02T15:04:05.999Z07:00", // RFC3339 at millisecond precision
@@ -64,41 +78,82 @@ func initLog() {
 	}
 }
 
-func initHTTPServer(certWatcher *certinel.Certinel) (*server.Server, error) {
-	caCertPool, err := certutils.LoadCACertFile(viper.GetString("ca-cert"))
+// certWatchers groups the components watching the TLS certificates.
+type certWatchers struct {
+	server *certwatcher.Watcher
+	ca     *certwatcher.CAWatcher
+	expiry *certwatcher.ExpiryMonitor
+}
+
+func initHTTPServer(certs *certWatchers) (*server.Server, error) {
+	authPolicy, err := initAuthPolicy()
 	if err != nil {
 		return nil, err
 	}
-	adminAuth := certauth.NewAuth(certauth.Options{
-		AllowedOUs: []string{"titan", "monitoring", "engineering"},
-	})
-	bindingAuth := certauth.NewAuth(certauth.Options{
-		AllowedOUs: []string{"titan", "monitoring", "engineering", "site"},
-	})
 	config := server.Config{
-		Port:               viper.GetInt("bind-port"),
-		BindAddress:        viper.GetString("bind-address"),
-		ServerCert:         viper.GetString("server-cert"),
-		ServerKey:          viper.GetString("server-key"),
-		CACertPool:         caCertPool,
-		AdminAuthHandler:   adminAuth.RouterHandler,
-		BindingAuthHandler: bindingAuth.RouterHandler,
-		CertWatcher:        certWatcher,
+		Port:         viper.GetInt("bind-port"),
+		BindAddress:  viper.GetString("bind-address"),
+		ServerCert:   viper.GetString("server-cert"),
+		ServerKey:    viper.GetString("server-key"),
+		AuthResolver: authPolicy.Resolve,
+		CertWatcher:  certs.server,
+		CAWatcher:    certs.ca,
+		// Off by default, the error responses would leak the internals.
+		Debug: viper.GetBool("debug"),
 	}
 	log.Infof("Starting TLS server: %+v", config)
-	return server.New(config), nil
+	return server.New(config)
+}
+
+func initAuthPolicy() (*server.AuthPolicy, error) {
+	var rules []server.PolicyRule
+	err := viper.UnmarshalKey("auth-policy", &rules)
+	if err != nil {
+		return nil, fmt.Errorf("auth-policy config error: %s", err)
+	}
+	log.Infof("Auth policy loaded: %+v", rules)
+	return server.NewAuthPolicy(rules)
 }
 
-func initHealthz(s *server.Server) error {
+func initHealthz(ctx context.Context, s *server.Server, certs *certWatchers) error {
 	config := healthz.Config{
 		BindPort: viper.GetInt("port-healthz"),
 		BindAddr: viper.GetString("bind-address-healthz"),
 		Hostname: viper.GetString("pod-name"),
+		// Zero falls back to healthz.DefaultTimeout.
+		DefaultTimeout: viper.GetDuration("healthz-default-timeout"),
+		// Zero runs the checks on each request instead of in the background.
+		CheckInterval: viper.GetDuration("healthz-check-interval"),
+		HistorySize:   viper.GetInt("healthz-history-size"),
+		Version:       version,
+		ServiceID:     appName,
 		Providers: []healthz.ProviderInfo{
 			{
 				Type:        "App",
 				Description: "Check app health.",
 				Check:       s.App,
+				Probes:      healthz.Readiness | healthz.Startup,
+			},
+			{
+				Type:        "CertWatcher",
+				Description: "Check the server certificate reloads.",
+				Check:       certs.server,
+				// A failed reload keeps the previous certificate, so it only
+				// gates startup until the first certificate is loaded.
+				Probes: healthz.Startup,
+			},
+			{
+				Type:        "CAWatcher",
+				Description: "Check the client CA bundle reloads.",
+				Check:       certs.ca,
+				Probes:      healthz.Startup,
+			},
+			{
+				Type:        "CertExpiry",
+				Description: "Check the server and CA certificates are not about to expire.",
+				Check:       certs.expiry,
+				Probes:      healthz.Readiness,
+				Criticality: healthz.Warning,
 			},
 		},
 	}
@@ -112,12 +167,15 @@ func initHealthz(s *server.Server) error {
 		return err
 	}
 	s.HealthzHandler = healthServer.HandleHealthz
+	s.ReadinessHandler = healthServer.HandleReadiness
+	s.LivenessHandler = healthServer.HandleLiveness
 	log.Infof("Healthz loaded: %+v", healthServer)
+	go healthServer.RunChecks(ctx)
 	go healthServer.StartHealthz()
 	return nil
 }
 
-func initMetrics() error {
+func initMetrics(ctx context.Context) (<-chan struct{}, error) {
 	// Metrics config
 	metricsConfig := appmetrics.Config{
 		DebugBindPort:  viper.GetInt("port-debug"),
@@ -126,22 +184,100 @@ func initMetrics() error {
 		MetricHostname: viper.GetString("metric-hostname"),
 		AppName:        appName,
 		FlushInterval:  viper.GetDuration("metric-flush-interval"),
+		// Empty falls back to TCP and appmetrics.DefaultGraphitePrefix.
+		GraphiteProtocol: viper.GetString("graphite-protocol"),
+		GraphitePrefix:   viper.GetString("graphite-prefix"),
+		// Zero disables the Prometheus exporter.
+		PrometheusBindPort: viper.GetInt("port-prometheus"),
+		PrometheusBindAddr: viper.GetString("bind-address-prometheus"),
+		PrometheusPath:     viper.GetString("prometheus-path"),
+		// Empty disables the StatsD sink.
+		StatsDHost: viper.GetString("statsd-host"),
+		DogStatsD:  viper.GetBool("statsd-dogstatsd"),
+		PodName:    viper.GetString("pod-name"),
+		// Zero disables the runtime and process metrics.
+		RuntimeMetricsInterval: viper.GetDuration("runtime-metrics-interval"),
+	}
+	return appmetrics.Run(ctx, metricsConfig)
+}
+
+func initTracing(ctx context.Context) (func(context.Context) error, error) {
+	return tracing.Start(ctx, tracing.Config{
+		// Empty disables the span export.
+		Endpoint:    viper.GetString("tracing-endpoint"),
+		URLPath:     viper.GetString("tracing-url-path"),
+		Insecure:    viper.GetBool("tracing-insecure"),
+		Headers:     viper.GetStringMapString("tracing-headers"),
+		SampleRatio: viper.GetFloat64("tracing-sample-ratio"),
+		ServiceName: appName,
+		Version:     version,
+	})
+}
+
+// initNotifier returns the notifier of the panics, nil when no webhook is
+// configured.
+func initNotifier() (app.Notifier, error) {
+	webhookURL := viper.GetString("notify-webhook-url")
+	if webhookURL == "" {
+		log.Info("no notification webhook specified, not sending critical notifications")
+		return nil, nil
 	}
-	return appmetrics.Run(metricsConfig)
+	source := appName
+	if pod := viper.GetString("pod-name"); pod != "" {
+		source += "/" + pod
+	}
+	return app.NewWebhookNotifier(webhookURL, source)
 }
 
-func initCertWatcher() *certinel.Certinel {
-	return certwatcher.Start(viper.GetString("server-cert"), viper.GetString("server-key"))
+func initCertWatchers() (*certWatchers, error) {
+	watch := certwatcher.WatchConfig{
+		Mode:         viper.GetString("cert-watch-mode"),
+		PollInterval: viper.GetDuration("cert-poll-interval"),
+	}
+	var sniCerts []certwatcher.KeyPair
+	err := viper.UnmarshalKey("server-sni-certs", &sniCerts)
+	if err != nil {
+		return nil, fmt.Errorf("server-sni-certs config error: %s", err)
+	}
+	serverCert, err := certwatcher.Start(certwatcher.Config{
+		Cert:        viper.GetString("server-cert"),
+		Key:         viper.GetString("server-key"),
+		MaxFailures: viper.GetInt("cert-reload-max-failures"),
+		Watch:       watch,
+		SNI:         sniCerts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := certwatcher.StartCA(viper.GetString("ca-cert"), watch)
+	if err != nil {
+		return nil, err
+	}
+	expiry := certwatcher.NewExpiryMonitor(certwatcher.ExpiryConfig{
+		GetCertificate:  serverCert.GetCertificate,
+		SNICertificates: serverCert.SNICertificates,
+		CACerts:         caCert.Certificates,
+		Threshold:       viper.GetDuration("cert-expiry-threshold"),
+		Interval:        viper.GetDuration("cert-expiry-check-interval"),
+	})
+	return &certWatchers{
+		server: serverCert,
+		ca:     caCert,
+		expiry: expiry,
+	}, nil
 }
 
-func runServer(serverCtx context.Context, a *app.App, certWatcher *certinel.Certinel) {
+func runServer(serverCtx context.Context, a *app.App, certs *certWatchers) {
 	// HTTP server
-	httpServer, err := initHTTPServer(certWatcher)
+	httpServer, err := initHTTPServer(certs)
 	fatalIfErr(err)
 	httpServer.App = a
 
+	// Certificate expiry monitoring
+	go certs.expiry.Run(serverCtx)
+
 	// Healthz checker
-	err = initHealthz(httpServer)
+	err = initHealthz(serverCtx, httpServer, certs)
 	fatalIfErr(err)
 
 	log.Info("Starting service")
@@ -158,8 +294,16 @@ func main() {
 
 	initLog()
 
+	workerCtx, workerShutdown := context.WithCancel(context.Background())
+	serverCtx, serverShutdown := context.WithCancel(context.Background())
+	workerWg := &sync.WaitGroup{}
+
 	// Metrics
-	err = initMetrics()
+	metricsDone, err := initMetrics(serverCtx)
+	fatalIfErr(err)
+
+	// Tracing
+	tracingShutdown, err := initTracing(serverCtx)
 	fatalIfErr(err)
 
 	// Application container
@@ -167,13 +311,11 @@ func main() {
 		WorkerSleep: viper.GetDuration("worker-sleep"),
 		DemoMetrics: viper.GetStringSlice("demo-metrics"),
 	}
+	appConfig.Notifier, err = initNotifier()
+	fatalIfErr(err)
 	a, err := app.New(appConfig)
 	fatalIfErr(err)
 
-	workerCtx, workerShutdown := context.WithCancel(context.Background())
-	serverCtx, serverShutdown := context.WithCancel(context.Background())
-	workerWg := &sync.WaitGroup{}
-
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
@@ -185,6 +327,20 @@ func main() {
 
 			serverShutdown()
 
+			// Wait for the last metrics flush and the metrics servers.
+			select {
+			case <-metricsDone:
+			case <-time.After(metricsShutdownTimeout):
+				log.Warn("timed out waiting for the metrics to be flushed")
+			}
+
+			// Flush the pending spans.
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := tracingShutdown(ctx); err != nil {
+				log.WithError(err).Error("unable to flush the pending spans")
+			}
+			cancel()
+
 			os.Exit(0)
 		}
 	}()
@@ -192,8 +348,9 @@ func main() {
 	log.Info("Running workers")
 	a.RunWorkers(workerCtx, workerWg)
 
-	certWatcher := initCertWatcher()
-	runServer(serverCtx, a, certWatcher)
+	certs, err := initCertWatchers()
+	fatalIfErr(err)
+	runServer(serverCtx, a, certs)
 }
 
 func fatalIfErr(err error) {
@@ -5,6 +5,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/pantheon-systems/go-demo-service/pkg/appmetrics"
+	metrics "github.com/rcrowley/go-metrics"
 	"github.com/sirupsen/logrus"
 )
 
@@ -15,19 +17,25 @@ type WorkerFunc func(context.Context) error
 type Config struct {
 	WorkerSleep time.Duration
 	DemoMetrics []string
+	// Notifier receives the panics of the workers and handlers, none are
+	// sent when nil.
+	Notifier Notifier
 }
 
 type App struct {
 	WorkerSleep time.Duration
+	Notifier    Notifier
 }
 
 func New(config Config) (*App, error) {
 	a := &App{
 		WorkerSleep: config.WorkerSleep,
+		Notifier:    config.Notifier,
 	}
 	// Registering zones for metrics charts (stats is a package level variable).
 	stats = &demoMetrics{
 		demoCounter: initDemoMetrics(config.DemoMetrics),
+		panicCount:  appmetrics.GetOrRegisterCounter("worker.panics", appmetrics.Tags{"worker": "demo"}, metrics.DefaultRegistry),
 	}
 	return a, nil
 }
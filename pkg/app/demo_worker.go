@@ -2,9 +2,12 @@ package app
 
 import (
 	"context"
-	"runtime"
+	"fmt"
 	"runtime/debug"
 	"time"
+
+	"github.com/pantheon-systems/go-demo-service/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // MonitorWorker runs the monitoring goroutine that performs cleanup and
@@ -15,28 +18,22 @@ func (a *App) DemoWorker(ctx context.Context) error {
 		log.Info("shut down")
 		if err := recover(); err != nil {
 			stack := string(debug.Stack())
-			//stats.panicCount.Inc(1)
-			b := make([]byte, 1024*8)
-			runtime.Stack(b, false)
+			stats.panicCount.Inc(1)
 			log.WithField("severity", "critical").WithField("stack", stack).Error("runtime panic: ", err)
-			// TODO: send panics to slack when running in production.
-			//go s.SlackMessenger.SendCritical(fmt.Sprintf("Application panic: %s", err))
-			//stats.panicCount.Inc(1)
+			a.NotifyCritical(fmt.Sprintf("Application panic in DemoWorker: %v", err))
 		}
 	}()
 
 	iterCount := 0
 	// It takes a.MonitorWorkerSleep until the first worker runs.
 	// We don't want health checks to fail while we wait for this first run.
-	log.Infof("Running worker, iter: %d", iterCount)
-	a.MonitorWorkerTasks()
+	a.demoWorkerIteration(ctx, iterCount)
 
 	for {
 		select {
 		case <-time.After(a.WorkerSleep):
 			iterCount++
-			log.Infof("Running demo worker, iter: %d", iterCount)
-			a.MonitorWorkerTasks()
+			a.demoWorkerIteration(ctx, iterCount)
 		case <-ctx.Done():
 			log.Info("DemoWorker received shutdown signal")
 			return nil
@@ -44,12 +41,23 @@ func (a *App) DemoWorker(ctx context.Context) error {
 	}
 }
 
-func (a *App) MonitorWorkerTasks() {
-	a.DemoTask()
+// demoWorkerIteration runs an iteration of the demo worker in its own trace.
+func (a *App) demoWorkerIteration(ctx context.Context, iterCount int) {
+	ctx, span := tracing.Tracer().Start(ctx, "DemoWorker.iteration")
+	defer span.End()
+	span.SetAttributes(attribute.Int("worker.iteration", iterCount))
+	log.WithContext(ctx).WithField("worker", "demo").Infof("Running demo worker, iter: %d", iterCount)
+	a.MonitorWorkerTasks(ctx)
+}
+
+func (a *App) MonitorWorkerTasks(ctx context.Context) {
+	ctx, span := tracing.Tracer().Start(ctx, "MonitorWorkerTasks")
+	defer span.End()
+	a.DemoTask(ctx)
 }
 
-func (a *App) DemoTask() {
+func (a *App) DemoTask(ctx context.Context) {
 	// Always check last minute.
 	// TODO: figure out if we want to make this configurable.
-	log.Infoln("Running demo task")
+	log.WithContext(ctx).Infoln("Running demo task")
 }
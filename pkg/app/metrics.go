@@ -1,8 +1,7 @@
 package app
 
 import (
-	"fmt"
-
+	"github.com/pantheon-systems/go-demo-service/pkg/appmetrics"
 	metrics "github.com/rcrowley/go-metrics"
 )
 
@@ -11,19 +10,19 @@ type DemoCounter map[string]metrics.Gauge
 
 type demoMetrics struct {
 	demoCounter DemoCounter
+	// panicCount counts the panics recovered by the DemoWorker.
+	panicCount metrics.Counter
 }
 
-// TODO: stats is unused. Is there a reason to leave it in place for the demo app?
-//nolint:unused
 var stats *demoMetrics
 
 func initDemoMetrics(demoMetrics []string) DemoCounter {
-	// telemetry.go-demo-service.demo_metrics.(metric-(a,b,c,f)).(demo_number)
+	// demo_metrics tagged by zone, e.g. telemetry.go-demo-service.demo_metrics.(zone) in Graphite.
 	log.Infof("Registering demo stats: %s", demoMetrics)
 	gauge := make(DemoCounter, len(demoMetrics))
 	for _, demoMetric := range demoMetrics {
 		log.Infof("Registering site downtime metrics for zone: %s", demoMetric)
-		gauge[demoMetric] = metrics.GetOrRegisterGauge(fmt.Sprintf("demo_metrics.%s.", demoMetric), metrics.DefaultRegistry)
+		gauge[demoMetric] = appmetrics.GetOrRegisterGauge("demo_metrics", appmetrics.Tags{"zone": demoMetric}, metrics.DefaultRegistry)
 	}
 	return gauge
 }
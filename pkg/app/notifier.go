@@ -0,0 +1,106 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// notifyTimeout bounds the time spent sending a notification.
+const notifyTimeout = 10 * time.Second
+
+// Notifier dispatches critical notifications, e.g. to a chat channel or a
+// pager.
+type Notifier interface {
+	SendCritical(ctx context.Context, message string) error
+}
+
+// NotifierFunc adapts a func to a Notifier.
+type NotifierFunc func(ctx context.Context, message string) error
+
+// SendCritical implements Notifier.
+func (f NotifierFunc) SendCritical(ctx context.Context, message string) error {
+	return f(ctx, message)
+}
+
+// NotifyCritical sends message with the Notifier of the app in the
+// background. It does nothing when the app has no Notifier.
+func (a *App) NotifyCritical(message string) {
+	if a == nil || a.Notifier == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		if err := a.Notifier.SendCritical(ctx, message); err != nil {
+			log.WithError(err).Error("unable to send the critical notification")
+		}
+	}()
+}
+
+// WebhookNotifier posts the notifications to a webhook as JSON with a
+// `text` field, the payload of the Slack incoming webhooks.
+type WebhookNotifier struct {
+	url    string
+	source string
+	client *http.Client
+}
+
+// NewWebhookNotifier returns a Notifier posting to the http(s) webhookURL.
+// The messages are prefixed by source, e.g. the app and pod names.
+func NewWebhookNotifier(webhookURL, source string) (*WebhookNotifier, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook URL: %s", unwrapURLError(err))
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL: an http or https URL is required")
+	}
+	return &WebhookNotifier{
+		url:    webhookURL,
+		source: source,
+		client: &http.Client{Timeout: notifyTimeout},
+	}, nil
+}
+
+// SendCritical implements Notifier.
+func (n *WebhookNotifier) SendCritical(ctx context.Context, message string) error {
+	if n.source != "" {
+		message = fmt.Sprintf("[%s] %s", n.source, message)
+	}
+	payload, err := json.Marshal(struct {
+		Text string `json:"text"`
+	}{message})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req.WithContext(ctx))
+	if err != nil {
+		// The error holds the URL, which often embeds a secret token.
+		return fmt.Errorf("unable to post to the webhook: %s", unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+func unwrapURLError(err error) error {
+	if uerr, ok := err.(*url.Error); ok {
+		return uerr.Err
+	}
+	return err
+}
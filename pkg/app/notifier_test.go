@@ -0,0 +1,87 @@
+package app_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pantheon-systems/go-demo-service/pkg/app"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	messages := make(chan string, 1)
+	status := http.StatusOK
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Text string `json:"text"`
+		}
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("expected a JSON POST, got %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		messages <- payload.Text
+		w.WriteHeader(status)
+	}))
+	defer webhook.Close()
+
+	n, err := app.NewWebhookNotifier(webhook.URL+"/services/secret", "go-demo-service/pod-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.SendCritical(context.Background(), "panic"); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-messages; got != "[go-demo-service/pod-1] panic" {
+		t.Errorf("expected the message prefixed by the source, got %q", got)
+	}
+
+	status = http.StatusForbidden
+	err = n.SendCritical(context.Background(), "panic")
+	<-messages
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected an error for a failed delivery, got %v", err)
+	}
+
+	webhook.Close()
+	err = n.SendCritical(context.Background(), "panic")
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected an error without the webhook URL, got %v", err)
+	}
+}
+
+func TestNewWebhookNotifierInvalidURL(t *testing.T) {
+	for _, u := range []string{"hooks.slack.com/services/x", "ftp://example.com", "https://"} {
+		if _, err := app.NewWebhookNotifier(u, ""); err == nil {
+			t.Errorf("expected an error for %q", u)
+		}
+	}
+}
+
+func TestNotifyCritical(t *testing.T) {
+	messages := make(chan string, 1)
+	a := &app.App{Notifier: app.NotifierFunc(func(ctx context.Context, message string) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expected the notification to be bounded in time")
+		}
+		messages <- message
+		return nil
+	})}
+	a.NotifyCritical("panic")
+	select {
+	case got := <-messages:
+		if got != "panic" {
+			t.Errorf("expected the message to be sent, got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the notification to be sent")
+	}
+
+	// Without a Notifier nothing is sent.
+	(&app.App{}).NotifyCritical("panic")
+}
@@ -1,15 +1,16 @@
 package appmetrics
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
-	graphite "github.com/pantheon-systems/go-metrics-graphite"
 	metrics "github.com/rcrowley/go-metrics"
-	"github.com/rcrowley/go-metrics/exp"
 )
 
 var log = logrus.WithField("component", "appmetrics")
@@ -21,12 +22,13 @@ type MethodMetrics struct {
 	Timer   metrics.Timer
 }
 
-// NewMethodMetrics returns a pointer to a MethodMetrics using the given name.
-func NewMethodMetrics(name string) *MethodMetrics {
+// NewMethodMetrics returns a pointer to a MethodMetrics using the given name
+// and tags.
+func NewMethodMetrics(name string, tags Tags) *MethodMetrics {
 	return &MethodMetrics{
-		Success: metrics.GetOrRegister(name+".success", makeCounterFunc).(metrics.Counter),
-		Fail:    metrics.GetOrRegister(name+".failed", makeCounterFunc).(metrics.Counter),
-		Timer:   metrics.GetOrRegister(name+".timer", makeTimerFunc).(metrics.Timer),
+		Success: GetOrRegisterCounter(name+".success", tags, nil),
+		Fail:    GetOrRegisterCounter(name+".failed", tags, nil),
+		Timer:   GetOrRegisterTimer(name+".timer", tags, nil),
 	}
 }
 
@@ -37,6 +39,15 @@ type ServerMetrics struct {
 	ConnectedTime metrics.Timer
 }
 
+// NewServerMetrics returns a pointer to a ServerMetrics using the given name.
+func NewServerMetrics(name string) *ServerMetrics {
+	return &ServerMetrics{
+		Sessions:      GetOrRegisterCounter(name+".sessions", nil, nil),
+		FailedSession: GetOrRegisterCounter(name+".failed_sessions", nil, nil),
+		ConnectedTime: GetOrRegisterTimer(name+".connected_time", nil, nil),
+	}
+}
+
 type Config struct {
 	DebugBindPort  int
 	DebugBindAddr  string
@@ -44,13 +55,30 @@ type Config struct {
 	MetricHostname string
 	AppName        string
 	FlushInterval  time.Duration
+	// GraphiteProtocol is GraphiteTCP or GraphiteUDP, GraphitePrefix a
+	// template of the metric names prefix of Graphite and StatsD, see
+	// GraphiteConfig.
+	GraphiteProtocol string
+	GraphitePrefix   string
+	// PrometheusBindPort enables the Prometheus exporter, serving the
+	// metrics at PrometheusPath, defaults to DefaultPrometheusPath.
+	PrometheusBindPort int
+	PrometheusBindAddr string
+	PrometheusPath     string
+	// StatsDHost enables the StatsD sink, sending to this host:port. With
+	// DogStatsD, the metrics are tagged with the app, host and pod names.
+	StatsDHost string
+	DogStatsD  bool
+	PodName    string
+	// RuntimeMetricsInterval enables the Go runtime and process metrics,
+	// captured at this interval.
+	RuntimeMetricsInterval time.Duration
 }
 
-var makeTimerFunc = func() interface{} { return metrics.NewTimer() }
-var makeCounterFunc = func() interface{} { return metrics.NewCounter() }
-
-// Run starts the goroutines and servers that handle metrics.
-func Run(config Config) error {
+// Run starts the goroutines and servers that handle metrics. The servers
+// are shut down and the sinks flushed a last time once ctx is done, the
+// returned channel is closed when they are.
+func Run(ctx context.Context, config Config) (<-chan struct{}, error) {
 	log.Debugf("Setup metrics with config: %+v", config)
 	reg := metrics.DefaultRegistry
 
@@ -58,29 +86,110 @@ func Run(config Config) error {
 	if config.MetricHostname == "" {
 		host, err := os.Hostname()
 		if err != nil {
-			return fmt.Errorf("could not detect hostname: %s", err.Error())
+			return nil, fmt.Errorf("could not detect hostname: %s", err.Error())
 		}
 		log.Info("autodetected hostname as: ", host)
 		config.MetricHostname = host
 	}
 
-	// Metrics, expvars and stats will be available for debugging at /debug/metrics, e.g.
+	// Profiles, expvars and metrics will be available for debugging at
+	// /debug/pprof/, /debug/vars and /debug/metrics, e.g.
 	// `http://localhost:6060/debug/metrics`
-	go exp.Exp(reg)
-	/*go func() {
-		profileAddr := fmt.Sprintf(config.DebugBindAddr+":%d", config.DebugBindPort)
-		log.Info("starting metrics debug server")
-		log.Info(http.ListenAndServe(profileAddr, nil))
-	}()*/
+	wg := &sync.WaitGroup{}
+	if config.DebugBindPort > 0 {
+		err := startServer(ctx, wg, "debug", &http.Server{
+			Addr:    fmt.Sprintf("%s:%d", config.DebugBindAddr, config.DebugBindPort),
+			Handler: DebugHandler(reg),
+			// No WriteTimeout, CPU profiles and traces take as long as asked.
+			ReadTimeout: 10 * time.Second,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.RuntimeMetricsInterval > 0 {
+		go CaptureRuntimeMetrics(ctx, reg, config.RuntimeMetricsInterval)
+	}
 
 	// Run the metric collector
 	if config.GraphiteHost != "" {
-		metricPrefix := fmt.Sprintf("telemetry.%s", config.AppName)
-		log.Infof("using graphite prefix: %s, graphite host: %s", metricPrefix, config.GraphiteHost)
-		go graphite.Graphite(reg, config.FlushInterval, metricPrefix, config.GraphiteHost)
+		g, err := NewGraphite(reg, GraphiteConfig{
+			Addr:          config.GraphiteHost,
+			Protocol:      config.GraphiteProtocol,
+			Prefix:        config.GraphitePrefix,
+			AppName:       config.AppName,
+			Hostname:      config.MetricHostname,
+			FlushInterval: config.FlushInterval,
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("using graphite prefix: %s, graphite host: %s", g.Prefix(), config.GraphiteHost)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Run(ctx)
+		}()
 	} else {
 		log.Warn("no Graphite server specified, not sending metrics")
 	}
 
-	return nil
+	if config.StatsDHost != "" {
+		prefix, err := graphitePrefix(GraphiteConfig{
+			Prefix:   config.GraphitePrefix,
+			AppName:  config.AppName,
+			Hostname: config.MetricHostname,
+		})
+		if err != nil {
+			return nil, err
+		}
+		statsdConfig := StatsDConfig{
+			Addr:          config.StatsDHost,
+			Prefix:        prefix,
+			FlushInterval: config.FlushInterval,
+			DogStatsD:     config.DogStatsD,
+		}
+		if config.DogStatsD {
+			statsdConfig.Tags = []string{"app:" + config.AppName, "host:" + config.MetricHostname}
+			if config.PodName != "" {
+				statsdConfig.Tags = append(statsdConfig.Tags, "pod:"+config.PodName)
+			}
+		}
+		statsd, err := NewStatsD(reg, statsdConfig)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("using statsd prefix: %s, statsd host: %s, tags: %v", statsdConfig.Prefix, statsdConfig.Addr, statsdConfig.Tags)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statsd.Run(ctx)
+		}()
+	}
+
+	if config.PrometheusBindPort > 0 {
+		path := config.PrometheusPath
+		if path == "" {
+			path = DefaultPrometheusPath
+		}
+		mux := http.NewServeMux()
+		mux.Handle(path, PrometheusHandler(reg, PrometheusName("", config.AppName)))
+		err := startServer(ctx, wg, "prometheus", &http.Server{
+			Addr:         fmt.Sprintf("%s:%d", config.PrometheusBindAddr, config.PrometheusBindPort),
+			Handler:      mux,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 30 * time.Second,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done, nil
 }
@@ -0,0 +1,76 @@
+package appmetrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+func TestRunDoneAfterFinalFlush(t *testing.T) {
+	conn, read := listenUDP(t)
+	defer conn.Close()
+	metrics.GetOrRegisterCounter("run.test", nil).Inc(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done, err := Run(ctx, Config{
+		MetricHostname: "test",
+		AppName:        "app",
+		StatsDHost:     conn.LocalAddr().String(),
+		// Only the final flush is sent.
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+		t.Fatal("expected Run to be running until the context is done")
+	default:
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Run to be done once the context is done")
+	}
+	var packets []string
+	for !strings.Contains(strings.Join(packets, "\n"), "telemetry.app.run.test:") {
+		packets = append(packets, read())
+	}
+}
+
+func TestRunStatsDPrefix(t *testing.T) {
+	conn, read := listenUDP(t)
+	defer conn.Close()
+	metrics.GetOrRegisterCounter("run.prefix", nil).Inc(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done, err := Run(ctx, Config{
+		MetricHostname: "pod-1.example.com",
+		AppName:        "app",
+		GraphitePrefix: "metrics.{{.AppName}}.{{.Hostname}}",
+		StatsDHost:     conn.LocalAddr().String(),
+		FlushInterval:  time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	<-done
+	var packets []string
+	for !strings.Contains(strings.Join(packets, "\n"), "metrics.app.pod-1_example_com.run.prefix:") {
+		packets = append(packets, read())
+	}
+
+	_, err = Run(context.Background(), Config{
+		GraphitePrefix: "{{.Missing}}",
+		StatsDHost:     conn.LocalAddr().String(),
+	})
+	if err == nil {
+		t.Fatal("expected an error for an invalid prefix template")
+	}
+}
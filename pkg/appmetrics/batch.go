@@ -0,0 +1,53 @@
+package appmetrics
+
+import (
+	"bytes"
+	"net"
+)
+
+// defaultUDPPacketSize keeps the packets under the usual 1500 bytes MTU.
+const defaultUDPPacketSize = 1432
+
+// packetBatch writes newline separated lines in packets of at most max
+// bytes, so that no line is split across packets. A line longer than max is
+// sent in a packet of its own. With terminate, every line is followed by a
+// newline, including the last one of a packet.
+type packetBatch struct {
+	conn      net.Conn
+	max       int
+	terminate bool
+	buf       bytes.Buffer
+	err       error
+}
+
+func (b *packetBatch) add(line string) {
+	n := len(line)
+	if b.buf.Len() > 0 || b.terminate {
+		n++
+	}
+	if b.buf.Len() > 0 && b.buf.Len()+n > b.max {
+		b.send()
+	}
+	if b.buf.Len() > 0 && !b.terminate {
+		b.buf.WriteByte('\n')
+	}
+	b.buf.WriteString(line)
+	if b.terminate {
+		b.buf.WriteByte('\n')
+	}
+}
+
+func (b *packetBatch) send() {
+	if _, err := b.conn.Write(b.buf.Bytes()); err != nil && b.err == nil {
+		b.err = err
+	}
+	b.buf.Reset()
+}
+
+// flush sends the pending lines and returns the first write error.
+func (b *packetBatch) flush() error {
+	if b.buf.Len() > 0 {
+		b.send()
+	}
+	return b.err
+}
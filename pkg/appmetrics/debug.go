@@ -0,0 +1,62 @@
+package appmetrics
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/rcrowley/go-metrics/exp"
+)
+
+// shutdownTimeout bounds the graceful shutdown of the metrics servers.
+const shutdownTimeout = 5 * time.Second
+
+// DebugHandler serves the debug endpoints:
+//   - /debug/pprof/: the runtime profiles.
+//   - /debug/vars: the expvars.
+//   - /debug/metrics: the metrics of reg, with the expvars.
+func DebugHandler(reg metrics.Registry) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/debug/metrics", exp.ExpHandler(reg))
+	return mux
+}
+
+// startServer listens on the address of server and serves it until ctx is
+// done, wg is done once the server is shut down. It fails if the address
+// cannot be listened on.
+func startServer(ctx context.Context, wg *sync.WaitGroup, name string, server *http.Server) error {
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("unable to start the %s server: %s", name, err)
+	}
+	log.Infof("serving %s on %s", name, ln.Addr())
+	go func() {
+		err := server.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Errorf("%s server stopped", name)
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.WithError(err).Errorf("unable to shut down the %s server", name)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,54 @@
+package appmetrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+func TestDebugHandler(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("debug.test", reg).Inc(1)
+	h := DebugHandler(reg)
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/vars", "/debug/metrics"} {
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: want 200 response code, got: %d", path, w.Code)
+		}
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("want 404 response code outside of /debug, got: %d", w.Code)
+	}
+}
+
+func TestStartServerShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	server := &http.Server{Addr: "localhost:0", Handler: http.NotFoundHandler()}
+	wg := &sync.WaitGroup{}
+	if err := startServer(ctx, wg, "test", server); err != nil {
+		t.Fatal(err)
+	}
+	shutdown := make(chan struct{})
+	server.RegisterOnShutdown(func() { close(shutdown) })
+	cancel()
+	select {
+	case <-shutdown:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the server to shut down once the context is done")
+	}
+	wg.Wait()
+
+	if err := startServer(context.Background(), wg, "test", &http.Server{Addr: "localhost:-1"}); err == nil {
+		t.Fatal("expected an error for an invalid address")
+	}
+}
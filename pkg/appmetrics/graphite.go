@@ -0,0 +1,234 @@
+package appmetrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// Graphite plaintext protocol transports.
+const (
+	GraphiteTCP = "tcp"
+	GraphiteUDP = "udp"
+)
+
+// DefaultGraphitePrefix keeps the prefix used before it could be templated.
+const DefaultGraphitePrefix = "telemetry.{{.AppName}}"
+
+// DefaultGraphiteFlushInterval is used when GraphiteConfig.FlushInterval is
+// not set.
+const DefaultGraphiteFlushInterval = 10 * time.Second
+
+// DefaultGraphiteMaxBackoff bounds the delay between flushes after failures
+// when GraphiteConfig.MaxBackoff is not set.
+const DefaultGraphiteMaxBackoff = 5 * time.Minute
+
+// graphiteTimeout bounds connecting and writing a flush.
+const graphiteTimeout = 10 * time.Second
+
+// graphiteTCPPacketSize is the size of the writes to a TCP connection.
+const graphiteTCPPacketSize = 32 * 1024
+
+// graphitePercentiles are sent for timers and histograms.
+var graphitePercentiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+// GraphiteConfig configures a Graphite sink.
+type GraphiteConfig struct {
+	// Addr is the host:port of the Graphite plaintext endpoint.
+	Addr string
+	// Protocol is GraphiteTCP or GraphiteUDP, defaults to GraphiteTCP.
+	Protocol string
+	// Prefix is a text/template of the metric name prefix, executed with
+	// the AppName and Hostname, defaults to DefaultGraphitePrefix.
+	Prefix   string
+	AppName  string
+	Hostname string
+	// FlushInterval defaults to DefaultGraphiteFlushInterval.
+	FlushInterval time.Duration
+	// MaxBackoff bounds the delay between flushes, doubled after each
+	// failure, defaults to DefaultGraphiteMaxBackoff.
+	MaxBackoff time.Duration
+}
+
+// Graphite flushes a registry to Graphite in the format of
+// go-metrics-graphite, so that existing dashboards keep working. The
+// outcome of each flush is counted in `graphite.flush.success` and
+// `graphite.flush.failure` of the registry.
+type Graphite struct {
+	reg     metrics.Registry
+	config  GraphiteConfig
+	prefix  string
+	success metrics.Counter
+	failure metrics.Counter
+}
+
+// NewGraphite returns a Graphite sink flushing reg to config.Addr. It fails
+// if the prefix template is invalid.
+func NewGraphite(reg metrics.Registry, config GraphiteConfig) (*Graphite, error) {
+	switch config.Protocol {
+	case "":
+		config.Protocol = GraphiteTCP
+	case GraphiteTCP, GraphiteUDP:
+	default:
+		return nil, fmt.Errorf("unknown graphite protocol %q, expected %q or %q", config.Protocol, GraphiteTCP, GraphiteUDP)
+	}
+	if config.Prefix == "" {
+		config.Prefix = DefaultGraphitePrefix
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultGraphiteFlushInterval
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultGraphiteMaxBackoff
+	}
+	prefix, err := graphitePrefix(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Graphite{
+		reg:     reg,
+		config:  config,
+		prefix:  prefix,
+		success: metrics.GetOrRegisterCounter("graphite.flush.success", reg),
+		failure: metrics.GetOrRegisterCounter("graphite.flush.failure", reg),
+	}, nil
+}
+
+// graphitePrefix executes the prefix template, DefaultGraphitePrefix if
+// unset. The dots of the hostname are replaced, so that it stays a single
+// path segment.
+func graphitePrefix(config GraphiteConfig) (string, error) {
+	if config.Prefix == "" {
+		config.Prefix = DefaultGraphitePrefix
+	}
+	tmpl, err := template.New("prefix").Option("missingkey=error").Parse(config.Prefix)
+	if err != nil {
+		return "", fmt.Errorf("invalid graphite prefix %q: %s", config.Prefix, err)
+	}
+	var prefix bytes.Buffer
+	err = tmpl.Execute(&prefix, struct {
+		AppName  string
+		Hostname string
+	}{
+		AppName:  config.AppName,
+		Hostname: strings.Replace(config.Hostname, ".", "_", -1),
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid graphite prefix %q: %s", config.Prefix, err)
+	}
+	return prefix.String(), nil
+}
+
+// Prefix returns the prefix of the metric names.
+func (g *Graphite) Prefix() string {
+	return g.prefix
+}
+
+// Run flushes the registry every FlushInterval until ctx is done, then
+// flushes a last time. After a failed flush, the delay to the next one is
+// doubled up to MaxBackoff. It should be run in a new goroutine.
+func (g *Graphite) Run(ctx context.Context) {
+	delay := g.config.FlushInterval
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			if err := g.Flush(); err != nil {
+				log.WithError(err).Error("unable to flush metrics to graphite on shutdown")
+			}
+			return
+		}
+		if err := g.Flush(); err != nil {
+			delay *= 2
+			if delay > g.config.MaxBackoff {
+				delay = g.config.MaxBackoff
+			}
+			log.WithError(err).WithField("retryIn", delay.String()).Warn("unable to flush metrics to graphite")
+		} else {
+			delay = g.config.FlushInterval
+		}
+		timer.Reset(delay)
+	}
+}
+
+// Flush sends the metrics of the registry once.
+func (g *Graphite) Flush() error {
+	err := g.flush()
+	if err != nil {
+		g.failure.Inc(1)
+		return err
+	}
+	g.success.Inc(1)
+	return nil
+}
+
+func (g *Graphite) flush() error {
+	conn, err := net.DialTimeout(g.config.Protocol, g.config.Addr, graphiteTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetWriteDeadline(time.Now().Add(graphiteTimeout)); err != nil {
+		return err
+	}
+	b := &packetBatch{conn: conn, max: graphiteTCPPacketSize, terminate: true}
+	if g.config.Protocol == GraphiteUDP {
+		b.max = defaultUDPPacketSize
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	g.reg.Each(func(name string, i interface{}) {
+		name = GraphiteName(name)
+		line := func(suffix, format string, value interface{}) {
+			b.add(fmt.Sprintf("%s.%s.%s "+format+" %s", g.prefix, name, suffix, value, now))
+		}
+		switch metric := i.(type) {
+		case metrics.Counter:
+			line("count", "%d", metric.Count())
+		case metrics.Gauge:
+			line("value", "%d", metric.Value())
+		case metrics.GaugeFloat64:
+			line("value", "%f", metric.Value())
+		case metrics.Histogram:
+			h := metric.Snapshot()
+			line("count", "%d", h.Count())
+			line("min", "%d", h.Min())
+			line("max", "%d", h.Max())
+			line("mean", "%.2f", h.Mean())
+			line("std-dev", "%.2f", h.StdDev())
+			for i, p := range h.Percentiles(graphitePercentiles) {
+				line(quantileName(graphitePercentiles[i]), "%.2f", p)
+			}
+		case metrics.Meter:
+			m := metric.Snapshot()
+			line("count", "%d", m.Count())
+			line("one-minute", "%.2f", m.Rate1())
+			line("five-minute", "%.2f", m.Rate5())
+			line("fifteen-minute", "%.2f", m.Rate15())
+			line("mean", "%.2f", m.RateMean())
+		case metrics.Timer:
+			t := metric.Snapshot()
+			line("count", "%d", t.Count())
+			line("min", "%d", t.Min())
+			line("max", "%d", t.Max())
+			line("mean", "%.2f", t.Mean())
+			line("std-dev", "%.2f", t.StdDev())
+			for i, p := range t.Percentiles(graphitePercentiles) {
+				line(quantileName(graphitePercentiles[i]), "%.2f", p)
+			}
+			line("one-minute", "%.2f", t.Rate1())
+			line("five-minute", "%.2f", t.Rate5())
+			line("fifteen-minute", "%.2f", t.Rate15())
+			line("mean-rate", "%.2f", t.RateMean())
+		}
+	})
+	return b.flush()
+}
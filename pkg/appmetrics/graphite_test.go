@@ -0,0 +1,183 @@
+package appmetrics
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// listenTCP returns a local TCP listener and a channel receiving the lines
+// sent over each accepted connection.
+func listenTCP(t *testing.T) (net.Listener, <-chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flushes := make(chan []string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			var lines []string
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				lines = append(lines, scanner.Text())
+			}
+			conn.Close()
+			flushes <- lines
+		}
+	}()
+	return ln, flushes
+}
+
+func TestGraphitePrefix(t *testing.T) {
+	g, err := NewGraphite(metrics.NewRegistry(), GraphiteConfig{
+		Prefix:   "telemetry.{{.AppName}}.{{.Hostname}}",
+		AppName:  "app",
+		Hostname: "pod-1.example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Prefix() != "telemetry.app.pod-1_example_com" {
+		t.Fatalf("unexpected prefix: %s", g.Prefix())
+	}
+
+	g, err = NewGraphite(metrics.NewRegistry(), GraphiteConfig{AppName: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Prefix() != "telemetry.app" {
+		t.Fatalf("unexpected default prefix: %s", g.Prefix())
+	}
+
+	for _, config := range []GraphiteConfig{
+		{Prefix: "{{.Missing}}"},
+		{Prefix: "{{"},
+		{Protocol: "http"},
+	} {
+		if _, err := NewGraphite(metrics.NewRegistry(), config); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
+
+func TestGraphiteFlushTCP(t *testing.T) {
+	ln, flushes := listenTCP(t)
+	defer ln.Close()
+
+	reg := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("demo.success", reg).Inc(3)
+	metrics.GetOrRegisterTimer("demo.timer", reg).Update(time.Millisecond)
+	GetOrRegisterGauge("demo_metrics", Tags{"zone": "us-east"}, reg).Update(1)
+	g, err := NewGraphite(reg, GraphiteConfig{Addr: ln.Addr().String(), AppName: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	lines := <-flushes
+	for _, e := range []string{
+		"telemetry.app.demo.success.count 3 ",
+		"telemetry.app.demo.timer.count 1 ",
+		"telemetry.app.demo.timer.999-percentile 1000000.00 ",
+		"telemetry.app.graphite.flush.success.count 0 ",
+		"telemetry.app.demo_metrics.us-east.value 1 ",
+	} {
+		if !hasPrefix(lines, e) {
+			t.Errorf("expected a line starting with %q, got:\n%s", e, strings.Join(lines, "\n"))
+		}
+	}
+	if reg.Get("graphite.flush.success").(metrics.Counter).Count() != 1 {
+		t.Error("expected the flush to be counted as a success")
+	}
+}
+
+func TestGraphiteFlushUDP(t *testing.T) {
+	conn, read := listenUDP(t)
+	defer conn.Close()
+
+	reg := metrics.NewRegistry()
+	metrics.GetOrRegisterGauge("demo.gauge", reg).Update(7)
+	g, err := NewGraphite(reg, GraphiteConfig{Addr: conn.LocalAddr().String(), Protocol: GraphiteUDP, Prefix: "p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	packet := read()
+	if !strings.HasSuffix(packet, "\n") || !hasPrefix(strings.Split(packet, "\n"), "p.demo.gauge.value 7 ") {
+		t.Fatalf("unexpected packet: %q", packet)
+	}
+}
+
+func TestGraphiteBackoff(t *testing.T) {
+	// Reserve a port and close it, so that connections are refused.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	reg := metrics.NewRegistry()
+	g, err := NewGraphite(reg, GraphiteConfig{
+		Addr:          addr,
+		FlushInterval: 10 * time.Millisecond,
+		MaxBackoff:    40 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	g.Run(ctx)
+
+	// Without backoff, about 30 flushes would have been attempted.
+	failures := reg.Get("graphite.flush.failure").(metrics.Counter).Count()
+	if failures < 3 || failures > 15 {
+		t.Fatalf("expected the failed flushes to back off, got %d failures", failures)
+	}
+}
+
+func TestGraphiteRunFlushesOnCancel(t *testing.T) {
+	ln, flushes := listenTCP(t)
+	defer ln.Close()
+
+	reg := metrics.NewRegistry()
+	metrics.GetOrRegisterGauge("last", reg).Update(1)
+	g, err := NewGraphite(reg, GraphiteConfig{Addr: ln.Addr().String(), Prefix: "p", FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	g.Run(ctx)
+	select {
+	case lines := <-flushes:
+		if !hasPrefix(lines, "p.last.value 1 ") {
+			t.Fatalf("unexpected final flush: %q", lines)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a final flush")
+	}
+}
+
+func hasPrefix(lines []string, prefix string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package appmetrics
+
+import (
+	"bufio"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// PrometheusContentType is the content type of the Prometheus text
+// exposition format.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultPrometheusPath is where the exporter serves metrics when
+// Config.PrometheusPath is not set.
+const DefaultPrometheusPath = "/metrics"
+
+// prometheusQuantiles are reported for timers and histograms.
+var prometheusQuantiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+// prometheusNameUnsafe matches the characters not allowed in a Prometheus
+// metric name.
+var prometheusNameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_:]+`)
+
+// PrometheusName turns a dotted go-metrics name into a Prometheus metric
+// name under namespace, e.g. `healthz.App.status` into
+// `go_demo_service_healthz_App_status`.
+func PrometheusName(namespace, name string) string {
+	if namespace != "" {
+		name = namespace + "_" + name
+	}
+	name = strings.Trim(prometheusNameUnsafe.ReplaceAllString(name, "_"), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// PrometheusHandler serves the metrics of reg in the Prometheus text
+// exposition format, with names prefixed by namespace:
+//   - counters as `<name>_total` counters.
+//   - gauges as gauges.
+//   - meters as `<name>_total` counters of their count, Prometheus computes
+//     the rates.
+//   - timers as `<name>_seconds` summaries.
+//   - histograms as summaries.
+func PrometheusHandler(reg metrics.Registry, namespace string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", PrometheusContentType)
+		bw := bufio.NewWriter(w)
+		writePrometheus(bw, reg, namespace)
+		if err := bw.Flush(); err != nil {
+			log.WithError(err).Debug("unable to write the prometheus metrics")
+		}
+	})
+}
+
+// prometheusSeries is a metric of the registry with its Prometheus name.
+type prometheusSeries struct {
+	key    string
+	name   string
+	labels string
+	metric interface{}
+}
+
+// writePrometheus writes the metrics of reg grouped by name, the series of a
+// name sorted by labels. Metrics whose sanitized name and labels collide
+// with an earlier one, or whose type differs from the other series of their
+// name, are skipped.
+func writePrometheus(w *bufio.Writer, reg metrics.Registry, namespace string) {
+	var all []prometheusSeries
+	reg.Each(func(key string, metric interface{}) {
+		suffix, ok := prometheusSuffix(metric)
+		if !ok {
+			log.Debugf("not exporting metric %s of unsupported type %T", key, metric)
+			return
+		}
+		name, tags := SplitTaggedName(key)
+		all = append(all, prometheusSeries{
+			key:    key,
+			name:   PrometheusName(namespace, name) + suffix,
+			labels: prometheusLabels(tags),
+			metric: metric,
+		})
+	})
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].name != all[j].name {
+			return all[i].name < all[j].name
+		}
+		return all[i].labels < all[j].labels
+	})
+
+	seen := map[string]bool{}
+	types := map[string]string{}
+	for _, series := range all {
+		if seen[series.name+series.labels] {
+			log.Warnf("not exporting metric %s, its name collides as %s", series.key, series.name)
+			continue
+		}
+		seen[series.name+series.labels] = true
+		typ := prometheusType(series.metric)
+		if t, ok := types[series.name]; ok && t != typ {
+			log.Warnf("not exporting metric %s, %s is already a %s", series.key, series.name, t)
+			continue
+		}
+		if _, ok := types[series.name]; !ok {
+			types[series.name] = typ
+			w.WriteString("# TYPE " + series.name + " " + typ + "\n")
+		}
+
+		name, labels := series.name, series.labels
+		switch m := series.metric.(type) {
+		case metrics.Counter:
+			writeSample(w, name, labels, float64(m.Count()))
+		case metrics.Gauge:
+			writeSample(w, name, labels, float64(m.Value()))
+		case metrics.GaugeFloat64:
+			writeSample(w, name, labels, m.Value())
+		case metrics.Meter:
+			writeSample(w, name, labels, float64(m.Snapshot().Count()))
+		case metrics.Timer:
+			t := m.Snapshot()
+			scale := float64(time.Second)
+			writeSummary(w, name, labels, t.Percentiles(prometheusQuantiles), t.Count(), scale)
+		case metrics.Histogram:
+			h := m.Snapshot()
+			writeSummary(w, name, labels, h.Percentiles(prometheusQuantiles), h.Count(), 1)
+		}
+	}
+}
+
+// prometheusLabelNameUnsafe matches the characters not allowed in a
+// Prometheus label name.
+var prometheusLabelNameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// prometheusLabelValueEscaper escapes Prometheus label values.
+var prometheusLabelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusLabels renders tags as the comma separated labels of a sample,
+// without braces.
+func prometheusLabels(tags []Tag) string {
+	labels := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		name := prometheusLabelNameUnsafe.ReplaceAllString(tag.Key, "_")
+		if name == "" || (name[0] >= '0' && name[0] <= '9') {
+			name = "_" + name
+		}
+		labels = append(labels, name+`="`+prometheusLabelValueEscaper.Replace(tag.Value)+`"`)
+	}
+	return strings.Join(labels, ",")
+}
+
+// prometheusType returns the Prometheus type metric is exported as.
+func prometheusType(metric interface{}) string {
+	switch metric.(type) {
+	case metrics.Counter, metrics.Meter:
+		return "counter"
+	case metrics.Timer, metrics.Histogram:
+		return "summary"
+	}
+	return "gauge"
+}
+
+// prometheusSuffix returns the suffix of the Prometheus name of metric, or
+// false if its type is not exported.
+func prometheusSuffix(metric interface{}) (string, bool) {
+	switch metric.(type) {
+	case metrics.Counter, metrics.Meter:
+		return "_total", true
+	case metrics.Timer:
+		return "_seconds", true
+	case metrics.Gauge, metrics.GaugeFloat64, metrics.Histogram:
+		return "", true
+	}
+	return "", false
+}
+
+func writeSample(w *bufio.Writer, name, labels string, value float64) {
+	w.WriteString(name + withLabels(labels) + " " + formatFloat(value) + "\n")
+}
+
+// writeSummary writes the samples of a summary of the quantile values,
+// divided by scale. There is no `_sum` sample: go-metrics only sums the
+// sampled values, which decreases as the reservoir evicts samples and would
+// break rate() in Prometheus.
+func writeSummary(w *bufio.Writer, name, labels string, values []float64, count int64, scale float64) {
+	for i, q := range prometheusQuantiles {
+		quantile := `quantile="` + formatFloat(q) + `"`
+		if labels != "" {
+			quantile = labels + "," + quantile
+		}
+		w.WriteString(name + withLabels(quantile) + " " + formatFloat(values[i]/scale) + "\n")
+	}
+	w.WriteString(name + "_count" + withLabels(labels) + " " + strconv.FormatInt(count, 10) + "\n")
+}
+
+// withLabels wraps non-empty labels in braces.
+func withLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
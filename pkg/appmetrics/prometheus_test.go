@@ -0,0 +1,105 @@
+package appmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+func TestPrometheusName(t *testing.T) {
+	tests := map[string]string{
+		"healthz.App.status":  "app_healthz_App_status",
+		"demo-metric.success": "app_demo_metric_success",
+		"weird..name!":        "app_weird_name",
+		"http:requests.2xx":   "app_http:requests_2xx",
+	}
+	for name, want := range tests {
+		if got := PrometheusName("app", name); got != want {
+			t.Errorf("PrometheusName(%q): want %q, got %q", name, want, got)
+		}
+	}
+	if got := PrometheusName("", "2xx"); got != "_2xx" {
+		t.Errorf("want a leading digit to be prefixed, got %q", got)
+	}
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("demo.success", reg).Inc(3)
+	metrics.GetOrRegisterGauge("healthz.App.status", reg).Update(1)
+	metrics.GetOrRegisterGaugeFloat64("load", reg).Update(0.5)
+	metrics.GetOrRegisterMeter("requests", reg).Mark(2)
+	timer := metrics.GetOrRegisterTimer("demo.timer", reg)
+	timer.Update(time.Second)
+	timer.Update(3 * time.Second)
+	histogram := metrics.GetOrRegisterHistogram("size", reg, metrics.NewUniformSample(10))
+	histogram.Update(10)
+	GetOrRegisterCounter("http.request.success", Tags{"route": "/v1/demo", "method": "GET"}, reg).Inc(1)
+	GetOrRegisterCounter("http.request.success", Tags{"route": "/v1/demo", "method": "POST"}, reg).Inc(2)
+	GetOrRegisterTimer("http.request.timer", Tags{"route": `/v1/"quoted"`}, reg).Update(time.Second)
+
+	r, _ := http.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	PrometheusHandler(reg, "app").ServeHTTP(w, r)
+	if w.Header().Get("Content-Type") != PrometheusContentType {
+		t.Fatalf("unexpected content type: %s", w.Header().Get("Content-Type"))
+	}
+
+	expected := []string{
+		"# TYPE app_demo_success_total counter\napp_demo_success_total 3\n",
+		"# TYPE app_healthz_App_status gauge\napp_healthz_App_status 1\n",
+		"# TYPE app_load gauge\napp_load 0.5\n",
+		"# TYPE app_requests_total counter\napp_requests_total 2\n",
+		"# TYPE app_demo_timer_seconds summary\n",
+		`app_demo_timer_seconds{quantile="0.5"} 2` + "\n",
+		`app_demo_timer_seconds{quantile="0.99"} 3` + "\n",
+		"app_demo_timer_seconds_count 2\n",
+		"# TYPE app_size summary\n",
+		"app_size_count 1\n",
+		"# TYPE app_http_request_success_total counter\n" +
+			`app_http_request_success_total{method="GET",route="/v1/demo"} 1` + "\n" +
+			`app_http_request_success_total{method="POST",route="/v1/demo"} 2` + "\n",
+		`app_http_request_timer_seconds{route="/v1/\"quoted\"",quantile="0.5"} 1` + "\n",
+		`app_http_request_timer_seconds_count{route="/v1/\"quoted\""} 1` + "\n",
+	}
+	body := w.Body.String()
+	for _, e := range expected {
+		if !strings.Contains(body, e) {
+			t.Errorf("expected %q in body:\n%s", e, body)
+		}
+	}
+}
+
+func TestPrometheusSummaryCumulative(t *testing.T) {
+	reg := metrics.NewRegistry()
+	timer := GetOrRegisterTimer("demo.timer", nil, reg)
+	scrape := func() string {
+		r, _ := http.NewRequest("GET", "/metrics", nil)
+		w := httptest.NewRecorder()
+		PrometheusHandler(reg, "app").ServeHTTP(w, r)
+		return w.Body.String()
+	}
+
+	// More samples than the reservoir holds, the slow ones get evicted.
+	for i := 0; i < 2000; i++ {
+		timer.Update(time.Second)
+	}
+	first := scrape()
+	for i := 0; i < 2000; i++ {
+		timer.Update(time.Millisecond)
+	}
+	second := scrape()
+
+	for _, body := range []string{first, second} {
+		if strings.Contains(body, "_sum") {
+			t.Errorf("expected no _sum of the sampled values, got:\n%s", body)
+		}
+	}
+	if !strings.Contains(first, "app_demo_timer_seconds_count 2000\n") || !strings.Contains(second, "app_demo_timer_seconds_count 4000\n") {
+		t.Errorf("expected a cumulative count, got:\n%s\n%s", first, second)
+	}
+}
@@ -0,0 +1,216 @@
+package appmetrics
+
+import (
+	"context"
+	"io/ioutil"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// memStatsGauges are the runtime.MemStats fields published as is under
+// `runtime.MemStats.`, the names go-metrics' RegisterRuntimeMemStats uses.
+var memStatsGauges = []struct {
+	name  string
+	value func(*runtime.MemStats) uint64
+}{
+	{"Alloc", func(m *runtime.MemStats) uint64 { return m.Alloc }},
+	{"BuckHashSys", func(m *runtime.MemStats) uint64 { return m.BuckHashSys }},
+	{"HeapAlloc", func(m *runtime.MemStats) uint64 { return m.HeapAlloc }},
+	{"HeapIdle", func(m *runtime.MemStats) uint64 { return m.HeapIdle }},
+	{"HeapInuse", func(m *runtime.MemStats) uint64 { return m.HeapInuse }},
+	{"HeapObjects", func(m *runtime.MemStats) uint64 { return m.HeapObjects }},
+	{"HeapReleased", func(m *runtime.MemStats) uint64 { return m.HeapReleased }},
+	{"HeapSys", func(m *runtime.MemStats) uint64 { return m.HeapSys }},
+	{"LastGC", func(m *runtime.MemStats) uint64 { return m.LastGC }},
+	{"MCacheInuse", func(m *runtime.MemStats) uint64 { return m.MCacheInuse }},
+	{"MCacheSys", func(m *runtime.MemStats) uint64 { return m.MCacheSys }},
+	{"MSpanInuse", func(m *runtime.MemStats) uint64 { return m.MSpanInuse }},
+	{"MSpanSys", func(m *runtime.MemStats) uint64 { return m.MSpanSys }},
+	{"NextGC", func(m *runtime.MemStats) uint64 { return m.NextGC }},
+	{"PauseTotalNs", func(m *runtime.MemStats) uint64 { return m.PauseTotalNs }},
+	{"StackInuse", func(m *runtime.MemStats) uint64 { return m.StackInuse }},
+	{"StackSys", func(m *runtime.MemStats) uint64 { return m.StackSys }},
+	{"Sys", func(m *runtime.MemStats) uint64 { return m.Sys }},
+	{"TotalAlloc", func(m *runtime.MemStats) uint64 { return m.TotalAlloc }},
+}
+
+// goMetrics holds the Go runtime metrics of a registry, named like those of
+// go-metrics, which can only be registered in a single registry:
+//   - runtime.MemStats.*: the memStatsGauges, along with the Frees, Lookups,
+//     Mallocs and NumGC counts since the previous capture, the GC pauses
+//     histogram PauseNs, GCCPUFraction, DebugGC and EnableGC.
+//   - runtime.NumGoroutine, runtime.NumThread: the goroutines and threads.
+//   - runtime.NumCgoCall: the cgo calls since the previous capture.
+//   - runtime.ReadMemStats: timer of the runtime.ReadMemStats calls.
+type goMetrics struct {
+	memStats      runtime.MemStats
+	gauges        []metrics.Gauge
+	debugGC       metrics.Gauge
+	enableGC      metrics.Gauge
+	frees         metrics.Gauge
+	lookups       metrics.Gauge
+	mallocs       metrics.Gauge
+	numGC         metrics.Gauge
+	gcCPUFraction metrics.GaugeFloat64
+	pauseNs       metrics.Histogram
+	numCgoCall    metrics.Gauge
+	numGoroutine  metrics.Gauge
+	numThread     metrics.Gauge
+	readMemStats  metrics.Timer
+	// The totals of the previous capture.
+	lastFrees, lastLookups, lastMallocs uint64
+	lastNumGC                           uint32
+	lastNumCgoCall                      int64
+}
+
+func newGoMetrics(reg metrics.Registry) *goMetrics {
+	gauge := func(name string) metrics.Gauge {
+		return metrics.GetOrRegisterGauge("runtime.MemStats."+name, reg)
+	}
+	m := &goMetrics{
+		debugGC:       gauge("DebugGC"),
+		enableGC:      gauge("EnableGC"),
+		frees:         gauge("Frees"),
+		lookups:       gauge("Lookups"),
+		mallocs:       gauge("Mallocs"),
+		numGC:         gauge("NumGC"),
+		gcCPUFraction: metrics.GetOrRegisterGaugeFloat64("runtime.MemStats.GCCPUFraction", reg),
+		pauseNs:       metrics.GetOrRegisterHistogram("runtime.MemStats.PauseNs", reg, metrics.NewExpDecaySample(1028, 0.015)),
+		numCgoCall:    metrics.GetOrRegisterGauge("runtime.NumCgoCall", reg),
+		numGoroutine:  metrics.GetOrRegisterGauge("runtime.NumGoroutine", reg),
+		numThread:     metrics.GetOrRegisterGauge("runtime.NumThread", reg),
+		readMemStats:  metrics.GetOrRegisterTimer("runtime.ReadMemStats", reg),
+	}
+	for _, g := range memStatsGauges {
+		m.gauges = append(m.gauges, gauge(g.name))
+	}
+	return m
+}
+
+// capture updates the metrics. runtime.ReadMemStats stops the world, hence
+// the interval of the captures should not be too short.
+func (m *goMetrics) capture() {
+	start := time.Now()
+	runtime.ReadMemStats(&m.memStats)
+	m.readMemStats.UpdateSince(start)
+	ms := &m.memStats
+
+	for i, g := range memStatsGauges {
+		m.gauges[i].Update(int64(g.value(ms)))
+	}
+	m.debugGC.Update(boolGauge(ms.DebugGC))
+	m.enableGC.Update(boolGauge(ms.EnableGC))
+	m.gcCPUFraction.Update(ms.GCCPUFraction)
+
+	m.frees.Update(int64(ms.Frees - m.lastFrees))
+	m.lookups.Update(int64(ms.Lookups - m.lastLookups))
+	m.mallocs.Update(int64(ms.Mallocs - m.lastMallocs))
+	m.numGC.Update(int64(ms.NumGC - m.lastNumGC))
+	// PauseNs is a circular buffer of the recent pauses, the pause of GC
+	// number n being at (n+255)%256.
+	pauses := ms.NumGC - m.lastNumGC
+	if n := uint32(len(ms.PauseNs)); pauses > n {
+		pauses = n
+	}
+	for gc := ms.NumGC - pauses; gc < ms.NumGC; gc++ {
+		m.pauseNs.Update(int64(ms.PauseNs[gc%uint32(len(ms.PauseNs))]))
+	}
+	m.lastFrees, m.lastLookups, m.lastMallocs, m.lastNumGC = ms.Frees, ms.Lookups, ms.Mallocs, ms.NumGC
+
+	numCgoCall := runtime.NumCgoCall()
+	m.numCgoCall.Update(numCgoCall - m.lastNumCgoCall)
+	m.lastNumCgoCall = numCgoCall
+	m.numGoroutine.Update(int64(runtime.NumGoroutine()))
+	m.numThread.Update(int64(threadCreateProfile.Count()))
+}
+
+func boolGauge(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// threadCreateProfile counts the threads created by the runtime.
+var threadCreateProfile = pprof.Lookup("threadcreate")
+
+// processMetrics holds the metrics of the process and scheduler:
+//   - runtime.gomaxprocs: the GOMAXPROCS value set by automaxprocs.
+//   - process.open_fds, process.max_fds: the open file descriptors and
+//     their limit.
+//   - process.cpu.user_seconds, process.cpu.system_seconds: the CPU time
+//     used by the process.
+type processMetrics struct {
+	gomaxprocs        metrics.Gauge
+	openFDs           metrics.Gauge
+	maxFDs            metrics.Gauge
+	cpuUserSeconds    metrics.GaugeFloat64
+	cpuSystemSeconds  metrics.GaugeFloat64
+	fdErrorLogged     bool
+	rusageErrorLogged bool
+}
+
+func newProcessMetrics(reg metrics.Registry) *processMetrics {
+	return &processMetrics{
+		gomaxprocs:       metrics.GetOrRegisterGauge("runtime.gomaxprocs", reg),
+		openFDs:          metrics.GetOrRegisterGauge("process.open_fds", reg),
+		maxFDs:           metrics.GetOrRegisterGauge("process.max_fds", reg),
+		cpuUserSeconds:   metrics.GetOrRegisterGaugeFloat64("process.cpu.user_seconds", reg),
+		cpuSystemSeconds: metrics.GetOrRegisterGaugeFloat64("process.cpu.system_seconds", reg),
+	}
+}
+
+// capture updates the metrics. Metrics the platform cannot provide are
+// left unset, the error is logged once.
+func (m *processMetrics) capture() {
+	m.gomaxprocs.Update(int64(runtime.GOMAXPROCS(0)))
+
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err == nil {
+		m.openFDs.Update(int64(len(fds)))
+	} else if !m.fdErrorLogged {
+		m.fdErrorLogged = true
+		log.WithError(err).Warn("unable to count the open file descriptors")
+	}
+
+	usage, err := readProcessUsage()
+	if err != nil {
+		if !m.rusageErrorLogged {
+			m.rusageErrorLogged = true
+			log.WithError(err).Warn("unable to read the process resource usage")
+		}
+		return
+	}
+	m.maxFDs.Update(usage.maxFDs)
+	m.cpuUserSeconds.Update(usage.user.Seconds())
+	m.cpuSystemSeconds.Update(usage.system.Seconds())
+}
+
+// processUsage is the resource usage of the process.
+type processUsage struct {
+	user, system time.Duration
+	maxFDs       int64
+}
+
+// CaptureRuntimeMetrics registers the Go runtime metrics in reg under
+// `runtime.` (memory, GC pauses, goroutines) along with the process
+// metrics, and captures them every interval until ctx is done. It should be
+// run in a new goroutine.
+func CaptureRuntimeMetrics(ctx context.Context, reg metrics.Registry, interval time.Duration) {
+	goRuntime := newGoMetrics(reg)
+	process := newProcessMetrics(reg)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		goRuntime.capture()
+		process.capture()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package appmetrics
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+func TestCaptureRuntimeMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// Captures once before returning on the cancelled context.
+	CaptureRuntimeMetrics(ctx, reg, time.Hour)
+
+	if n := reg.Get("runtime.NumGoroutine").(metrics.Gauge).Value(); n < 1 {
+		t.Errorf("expected the goroutines to be counted, got %d", n)
+	}
+	if n := reg.Get("runtime.gomaxprocs").(metrics.Gauge).Value(); n != int64(runtime.GOMAXPROCS(0)) {
+		t.Errorf("expected GOMAXPROCS %d, got %d", runtime.GOMAXPROCS(0), n)
+	}
+	if runtime.GOOS == "linux" {
+		if n := reg.Get("process.open_fds").(metrics.Gauge).Value(); n < 1 {
+			t.Errorf("expected the open file descriptors to be counted, got %d", n)
+		}
+		if n := reg.Get("process.max_fds").(metrics.Gauge).Value(); n < 1 {
+			t.Errorf("expected the file descriptor limit, got %d", n)
+		}
+	}
+}
+
+func TestCaptureRuntimeMetricsRegistries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// Each registry gets its own runtime metrics.
+	for i := 0; i < 2; i++ {
+		reg := metrics.NewRegistry()
+		runtime.GC()
+		CaptureRuntimeMetrics(ctx, reg, time.Hour)
+		if n := reg.Get("runtime.MemStats.HeapAlloc").(metrics.Gauge).Value(); n < 1 {
+			t.Errorf("registry %d: expected the heap to be measured, got %d", i, n)
+		}
+		if n := reg.Get("runtime.MemStats.NumGC").(metrics.Gauge).Value(); n < 1 {
+			t.Errorf("registry %d: expected the GCs since the start to be counted, got %d", i, n)
+		}
+		if n := reg.Get("runtime.MemStats.PauseNs").(metrics.Histogram).Count(); n < 1 {
+			t.Errorf("registry %d: expected the GC pauses to be recorded, got %d", i, n)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package appmetrics
+
+import (
+	"syscall"
+	"time"
+)
+
+func readProcessUsage() (processUsage, error) {
+	var rusage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &rusage); err != nil {
+		return processUsage{}, err
+	}
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return processUsage{}, err
+	}
+	return processUsage{
+		user:   time.Duration(rusage.Utime.Nano()),
+		system: time.Duration(rusage.Stime.Nano()),
+		maxFDs: int64(limit.Cur),
+	}, nil
+}
@@ -0,0 +1,7 @@
+package appmetrics
+
+import "errors"
+
+func readProcessUsage() (processUsage, error) {
+	return processUsage{}, errors.New("not supported on windows")
+}
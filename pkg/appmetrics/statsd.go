@@ -0,0 +1,176 @@
+package appmetrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// DefaultStatsDPacketSize keeps the packets under the usual 1500 bytes MTU.
+const DefaultStatsDPacketSize = defaultUDPPacketSize
+
+// DefaultStatsDFlushInterval is used when StatsDConfig.FlushInterval is not
+// set.
+const DefaultStatsDFlushInterval = 10 * time.Second
+
+// statsdQuantiles are sent as gauges for timers and histograms.
+var statsdQuantiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+// statsdNameUnsafe matches the characters with a meaning in the StatsD line
+// protocol.
+var statsdNameUnsafe = regexp.MustCompile(`[:|@#,\s]+`)
+
+// StatsDConfig configures a StatsD sink.
+type StatsDConfig struct {
+	// Addr is the host:port of the StatsD UDP endpoint.
+	Addr   string
+	Prefix string
+	// DogStatsD sends the metric tags and Tags in the DogStatsD format.
+	// Otherwise the metric tags are appended to the names like in Graphite
+	// and Tags are not sent.
+	DogStatsD bool
+	// Tags are appended to every metric, e.g. `app:go-demo-service`.
+	Tags []string
+	// FlushInterval defaults to DefaultStatsDFlushInterval.
+	FlushInterval time.Duration
+	// MaxPacketSize bounds the size of the packets metrics are batched in,
+	// defaults to DefaultStatsDPacketSize.
+	MaxPacketSize int
+}
+
+// StatsD flushes a registry to a StatsD endpoint. Counters and meters are
+// sent as the change since the previous flush, gauges as is, and timers and
+// histograms as gauges of their quantiles and mean along with their count.
+// Timer values are in milliseconds.
+type StatsD struct {
+	reg    metrics.Registry
+	config StatsDConfig
+	conn   net.Conn
+	// last holds the counts sent at the previous flush.
+	last map[string]int64
+}
+
+// NewStatsD returns a StatsD sink flushing reg to config.Addr.
+func NewStatsD(reg metrics.Registry, config StatsDConfig) (*StatsD, error) {
+	if config.MaxPacketSize <= 0 {
+		config.MaxPacketSize = DefaultStatsDPacketSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultStatsDFlushInterval
+	}
+	conn, err := net.Dial("udp", config.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach statsd at %s: %s", config.Addr, err)
+	}
+	s := &StatsD{
+		reg:    reg,
+		config: config,
+		conn:   conn,
+		last:   map[string]int64{},
+	}
+	return s, nil
+}
+
+// Run flushes the registry every FlushInterval until ctx is done, then
+// flushes a last time and closes the connection. It should be run in a new
+// goroutine.
+func (s *StatsD) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+	defer s.conn.Close()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if err := s.Flush(); err != nil {
+				log.WithError(err).Error("unable to flush metrics to statsd")
+			}
+			return
+		}
+		if err := s.Flush(); err != nil {
+			log.WithError(err).Error("unable to flush metrics to statsd")
+		}
+	}
+}
+
+// Flush sends the metrics of the registry, batched in packets of at most
+// MaxPacketSize bytes. Run calls it, so it must not be called concurrently
+// with Run.
+func (s *StatsD) Flush() error {
+	b := &packetBatch{conn: s.conn, max: s.config.MaxPacketSize}
+	s.reg.Each(func(key string, metric interface{}) {
+		name, tags := s.nameAndTags(key)
+		line := func(name, value, typ string) string {
+			return name + ":" + value + "|" + typ + tags
+		}
+		switch m := metric.(type) {
+		case metrics.Counter:
+			b.add(line(name, s.delta(key, m.Count()), "c"))
+		case metrics.Gauge:
+			b.add(line(name, strconv.FormatInt(m.Value(), 10), "g"))
+		case metrics.GaugeFloat64:
+			b.add(line(name, formatFloat(m.Value()), "g"))
+		case metrics.Meter:
+			b.add(line(name+".count", s.delta(key, m.Snapshot().Count()), "c"))
+		case metrics.Timer:
+			t := m.Snapshot()
+			scale := float64(time.Millisecond)
+			b.add(line(name+".count", s.delta(key, t.Count()), "c"))
+			b.add(line(name+".mean", formatFloat(t.Mean()/scale), "g"))
+			for i, v := range t.Percentiles(statsdQuantiles) {
+				b.add(line(name+"."+quantileName(statsdQuantiles[i]), formatFloat(v/scale), "g"))
+			}
+		case metrics.Histogram:
+			h := m.Snapshot()
+			b.add(line(name+".count", s.delta(key, h.Count()), "c"))
+			b.add(line(name+".mean", formatFloat(h.Mean()), "g"))
+			for i, v := range h.Percentiles(statsdQuantiles) {
+				b.add(line(name+"."+quantileName(statsdQuantiles[i]), formatFloat(v), "g"))
+			}
+		}
+	})
+	return b.flush()
+}
+
+// delta returns the change of the count of the registry key since the
+// previous flush.
+func (s *StatsD) delta(key string, count int64) string {
+	delta := count - s.last[key]
+	s.last[key] = count
+	return strconv.FormatInt(delta, 10)
+}
+
+// nameAndTags returns the StatsD name of a registry name, and the DogStatsD
+// tags suffix of its lines if enabled.
+func (s *StatsD) nameAndTags(key string) (string, string) {
+	name := GraphiteName(key)
+	var tags []string
+	if s.config.DogStatsD {
+		var metricTags []Tag
+		name, metricTags = SplitTaggedName(key)
+		for _, tag := range metricTags {
+			tags = append(tags, statsdNameUnsafe.ReplaceAllString(tag.Key, "_")+":"+statsdNameUnsafe.ReplaceAllString(tag.Value, "_"))
+		}
+		tags = append(tags, s.config.Tags...)
+	}
+	name = statsdNameUnsafe.ReplaceAllString(name, "_")
+	if s.config.Prefix != "" {
+		name = s.config.Prefix + "." + name
+	}
+	if len(tags) == 0 {
+		return name, ""
+	}
+	return name, "|#" + strings.Join(tags, ",")
+}
+
+// quantileName names a quantile like the graphite sink, e.g. 0.99 as
+// `99-percentile`.
+func quantileName(q float64) string {
+	return strings.Replace(formatFloat(q*100), ".", "", 1) + "-percentile"
+}
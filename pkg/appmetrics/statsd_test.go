@@ -0,0 +1,158 @@
+package appmetrics
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// listenUDP returns a local UDP listener and a func reading its next packet.
+func listenUDP(t *testing.T) (*net.UDPConn, func() string) {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, func() string {
+		t.Helper()
+		buf := make([]byte, 65536)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+}
+
+func TestStatsDFlush(t *testing.T) {
+	conn, read := listenUDP(t)
+	defer conn.Close()
+
+	reg := metrics.NewRegistry()
+	counter := metrics.GetOrRegisterCounter("demo.success", reg)
+	counter.Inc(3)
+	metrics.GetOrRegisterGauge("demo|gauge", reg).Update(7)
+	metrics.GetOrRegisterTimer("demo.timer", reg).Update(20 * time.Millisecond)
+	GetOrRegisterGauge("demo_metrics", Tags{"zone": "us-east"}, reg).Update(1)
+
+	s, err := NewStatsD(reg, StatsDConfig{
+		Addr:      conn.LocalAddr().String(),
+		Prefix:    "telemetry.app",
+		DogStatsD: true,
+		Tags:      []string{"app:app", "pod:pod-1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(read(), "\n")
+	expected := []string{
+		"telemetry.app.demo.success:3|c|#app:app,pod:pod-1",
+		"telemetry.app.demo_gauge:7|g|#app:app,pod:pod-1",
+		"telemetry.app.demo.timer.count:1|c|#app:app,pod:pod-1",
+		"telemetry.app.demo.timer.mean:20|g|#app:app,pod:pod-1",
+		"telemetry.app.demo.timer.99-percentile:20|g|#app:app,pod:pod-1",
+		"telemetry.app.demo.timer.999-percentile:20|g|#app:app,pod:pod-1",
+		"telemetry.app.demo_metrics:1|g|#zone:us-east,app:app,pod:pod-1",
+	}
+	for _, e := range expected {
+		if !contains(lines, e) {
+			t.Errorf("expected line %q, got:\n%s", e, strings.Join(lines, "\n"))
+		}
+	}
+
+	// Counters are sent as the change since the previous flush.
+	counter.Inc(2)
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(read(), "\n"); !contains(lines, "telemetry.app.demo.success:2|c|#app:app,pod:pod-1") {
+		t.Errorf("expected the counter delta, got:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestStatsDUntagged(t *testing.T) {
+	conn, read := listenUDP(t)
+	defer conn.Close()
+
+	reg := metrics.NewRegistry()
+	GetOrRegisterGauge("demo_metrics", Tags{"zone": "us-east"}, reg).Update(1)
+	s, err := NewStatsD(reg, StatsDConfig{Addr: conn.LocalAddr().String(), Tags: []string{"app:app"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if packet := read(); packet != "demo_metrics.us-east:1|g" {
+		t.Fatalf("expected the tags in the name only, got: %q", packet)
+	}
+}
+
+func TestStatsDBatching(t *testing.T) {
+	conn, read := listenUDP(t)
+	defer conn.Close()
+
+	reg := metrics.NewRegistry()
+	for _, name := range []string{"a", "b", "c", "d"} {
+		metrics.GetOrRegisterGauge(name, reg).Update(1)
+	}
+	// Each line is 5 bytes, so a packet holds two lines and their separator.
+	s, err := NewStatsD(reg, StatsDConfig{Addr: conn.LocalAddr().String(), MaxPacketSize: 11})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for i := 0; i < 2; i++ {
+		packet := read()
+		if len(packet) > 11 {
+			t.Fatalf("packet exceeds the max size: %q", packet)
+		}
+		lines = append(lines, strings.Split(packet, "\n")...)
+	}
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines in 2 packets, got: %q", lines)
+	}
+}
+
+func TestStatsDRunFlushesOnCancel(t *testing.T) {
+	conn, read := listenUDP(t)
+	defer conn.Close()
+
+	reg := metrics.NewRegistry()
+	metrics.GetOrRegisterGauge("last", reg).Update(1)
+	s, err := NewStatsD(reg, StatsDConfig{Addr: conn.LocalAddr().String(), FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	if packet := read(); packet != "last:1|g" {
+		t.Fatalf("expected a final flush, got: %q", packet)
+	}
+	<-done
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
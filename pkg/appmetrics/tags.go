@@ -0,0 +1,104 @@
+package appmetrics
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// Tags are the dimensions of a metric, e.g. the zone of a demo metric.
+//
+// Tagged metrics are registered in go-metrics registries under a name
+// encoded like Graphite tagged series, `name;key1=value1;key2=value2` with
+// the keys sorted. Each sink renders the tags its own way: the Graphite
+// sink appends the values to the dotted path, the Prometheus exporter turns
+// them into labels and the StatsD sink into DogStatsD tags when enabled.
+type Tags map[string]string
+
+// Tag is a single dimension of a metric.
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// tagUnsafe matches the characters separating the parts of a tagged name.
+var tagUnsafe = regexp.MustCompile(`[;=]`)
+
+// TaggedName encodes name and tags into a registry name.
+func TaggedName(name string, tags Tags) string {
+	if len(tags) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(name)
+	for _, key := range keys {
+		b.WriteString(";" + tagUnsafe.ReplaceAllString(key, "_") + "=" + tagUnsafe.ReplaceAllString(tags[key], "_"))
+	}
+	return b.String()
+}
+
+// SplitTaggedName decodes a registry name into the metric name and its tags
+// sorted by key. Untagged names have no tags.
+func SplitTaggedName(s string) (string, []Tag) {
+	parts := strings.Split(s, ";")
+	var tags []Tag
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		tags = append(tags, Tag{Key: kv[0], Value: kv[1]})
+	}
+	return parts[0], tags
+}
+
+// graphiteSegmentUnsafe matches the characters not allowed in a segment of
+// a dotted Graphite path.
+var graphiteSegmentUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// GraphiteName renders a registry name as a dotted Graphite path, with the
+// tag values appended in key order, e.g. `demo_metrics;zone=us-east` as
+// `demo_metrics.us-east`.
+func GraphiteName(s string) string {
+	name, tags := SplitTaggedName(s)
+	for _, tag := range tags {
+		value := strings.Trim(graphiteSegmentUnsafe.ReplaceAllString(tag.Value, "_"), "_")
+		if value == "" {
+			value = "_"
+		}
+		name += "." + value
+	}
+	return name
+}
+
+// GetOrRegisterCounter returns the counter of name and tags in reg, or in
+// metrics.DefaultRegistry if reg is nil.
+func GetOrRegisterCounter(name string, tags Tags, reg metrics.Registry) metrics.Counter {
+	return metrics.GetOrRegisterCounter(TaggedName(name, tags), reg)
+}
+
+// GetOrRegisterGauge returns the gauge of name and tags in reg, or in
+// metrics.DefaultRegistry if reg is nil.
+func GetOrRegisterGauge(name string, tags Tags, reg metrics.Registry) metrics.Gauge {
+	return metrics.GetOrRegisterGauge(TaggedName(name, tags), reg)
+}
+
+// GetOrRegisterTimer returns the timer of name and tags in reg, or in
+// metrics.DefaultRegistry if reg is nil.
+func GetOrRegisterTimer(name string, tags Tags, reg metrics.Registry) metrics.Timer {
+	return metrics.GetOrRegisterTimer(TaggedName(name, tags), reg)
+}
+
+// GetOrRegisterHistogram returns the histogram of name and tags in reg, or
+// in metrics.DefaultRegistry if reg is nil. New histograms use an
+// exponentially decaying sample.
+func GetOrRegisterHistogram(name string, tags Tags, reg metrics.Registry) metrics.Histogram {
+	return metrics.GetOrRegisterHistogram(TaggedName(name, tags), reg, metrics.NewExpDecaySample(1028, 0.015))
+}
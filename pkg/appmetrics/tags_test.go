@@ -0,0 +1,58 @@
+package appmetrics
+
+import (
+	"reflect"
+	"testing"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+func TestTaggedName(t *testing.T) {
+	name := TaggedName("http.request.success", Tags{"route": "/v1/demo-get", "method": "GET"})
+	if name != "http.request.success;method=GET;route=/v1/demo-get" {
+		t.Fatalf("unexpected tagged name: %s", name)
+	}
+	if TaggedName("plain", nil) != "plain" {
+		t.Fatal("expected an untagged name to be kept as is")
+	}
+	if name := TaggedName("demo", Tags{"k;=": "a=b;c"}); name != "demo;k__=a_b_c" {
+		t.Fatalf("expected the separators to be replaced, got: %s", name)
+	}
+
+	base, tags := SplitTaggedName("http.request.success;method=GET;route=/v1/demo-get")
+	if base != "http.request.success" || !reflect.DeepEqual(tags, []Tag{{"method", "GET"}, {"route", "/v1/demo-get"}}) {
+		t.Fatalf("unexpected split: %s %+v", base, tags)
+	}
+	if base, tags := SplitTaggedName("plain"); base != "plain" || tags != nil {
+		t.Fatalf("unexpected split of an untagged name: %s %+v", base, tags)
+	}
+}
+
+func TestGraphiteName(t *testing.T) {
+	tests := map[string]string{
+		"plain.name":                "plain.name",
+		"demo_metrics;zone=us-east": "demo_metrics.us-east",
+		"http.request.success;method=GET;route=/v1/demo-get": "http.request.success.GET.v1_demo-get",
+		"demo;zone=": "demo._",
+	}
+	for name, want := range tests {
+		if got := GraphiteName(name); got != want {
+			t.Errorf("GraphiteName(%q): want %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestGetOrRegisterTagged(t *testing.T) {
+	reg := metrics.NewRegistry()
+	c := GetOrRegisterCounter("demo", Tags{"zone": "a"}, reg)
+	c.Inc(1)
+	if GetOrRegisterCounter("demo", Tags{"zone": "a"}, reg) != c {
+		t.Fatal("expected the same counter for the same name and tags")
+	}
+	if GetOrRegisterCounter("demo", Tags{"zone": "b"}, reg) == c {
+		t.Fatal("expected another counter for other tags")
+	}
+	if reg.Get("demo;zone=a") != c {
+		t.Fatal("expected the counter to be registered under its tagged name")
+	}
+}
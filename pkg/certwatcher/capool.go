@@ -0,0 +1,95 @@
+package certwatcher
+
+import (
+	"crypto/x509"
+	"fmt"
+	"sync/atomic"
+)
+
+// CAWatcher hot reloads a CA bundle. A bundle that fails to load keeps the
+// previous one in use.
+type CAWatcher struct {
+	path  string
+	pool  atomic.Value // *x509.CertPool
+	certs atomic.Value // []*x509.Certificate
+
+	reloadTracker
+	notifier notifier
+}
+
+// StartCA loads the CA bundle at path and watches it for changes. It fails if
+// the initial load fails.
+func StartCA(path string, watch WatchConfig) (*CAWatcher, error) {
+	n, err := newNotifier(watch, path)
+	if err != nil {
+		return nil, err
+	}
+	w := &CAWatcher{
+		path:     path,
+		notifier: n,
+	}
+	if err := w.load(); err != nil {
+		n.Close()
+		return nil, err
+	}
+	go w.watch()
+	return w, nil
+}
+
+// CertPool returns the current CA pool.
+func (w *CAWatcher) CertPool() *x509.CertPool {
+	return w.pool.Load().(*x509.CertPool)
+}
+
+// Certificates returns the certificates of the current CA bundle.
+func (w *CAWatcher) Certificates() []*x509.Certificate {
+	return w.certs.Load().([]*x509.Certificate)
+}
+
+// HealthZ implements the healthz.HealthCheckable interface. It fails while
+// the latest reload attempt failed.
+func (w *CAWatcher) HealthZ() error {
+	return w.Status().err(fmt.Sprintf("CA bundle (%s)", w.path))
+}
+
+// Close stops watching the CA bundle.
+func (w *CAWatcher) Close() error {
+	return w.notifier.Close()
+}
+
+func (w *CAWatcher) watch() {
+	for {
+		select {
+		case <-w.notifier.C():
+			if err := w.load(); err != nil {
+				w.recordFailure(err)
+			}
+		case <-w.notifier.Done():
+			return
+		}
+	}
+}
+
+func (w *CAWatcher) load() error {
+	certs, err := LoadCACerts(w.path)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	w.certs.Store(certs)
+	w.pool.Store(pool)
+	if failures := w.reloaded(); failures > 0 {
+		log.Infof("CA bundle reloaded after %d failure(s)", failures)
+	}
+	log.Infof("Loaded CA bundle %s with %d certificate(s)", w.path, len(certs))
+	return nil
+}
+
+func (w *CAWatcher) recordFailure(err error) {
+	failures := w.failed(err)
+	log.WithError(err).WithField("consecutiveFailures", failures).
+		Errorf("unable to reload the CA bundle %s, keeping the previous one", w.path)
+}
@@ -0,0 +1,64 @@
+package certwatcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCAWatcherReload(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ca.crt")
+	copyFile(t, "../../test-fixtures/certs/ca.crt", path)
+
+	w, err := StartCA(path, WatchConfig{Mode: ModePoll, PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	pool := w.CertPool()
+	if len(w.Certificates()) != 2 {
+		t.Fatalf("expected 2 CA certificates, got: %d", len(w.Certificates()))
+	}
+
+	// A broken bundle keeps the previous pool.
+	writeFile(t, path, []byte("not a certificate"))
+	waitFor(t, func() bool { return w.HealthZ() != nil })
+	if w.CertPool() != pool {
+		t.Fatal("expected the previous CA pool to be kept after a failed reload")
+	}
+
+	copyFile(t, "../../test-fixtures/certs/client1.crt", path)
+	waitFor(t, func() bool { return w.HealthZ() == nil })
+	if w.CertPool() == pool {
+		t.Fatal("expected a new CA pool after the bundle changed")
+	}
+	if len(w.Certificates()) != 1 || w.Certificates()[0].Subject.CommonName != "client1" {
+		t.Fatalf("unexpected CA certificates after reload: %v", w.Certificates())
+	}
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dst, data)
+}
+
+// writeFile writes data and bumps the modification time, so that pollers
+// notice the change even within the filesystem timestamp resolution.
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(time.Duration(len(data)) * time.Second)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,26 +1,343 @@
 package certwatcher
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pantheon-systems/certinel"
-	"github.com/pantheon-systems/certinel/pollwatcher"
 	"github.com/sirupsen/logrus"
 )
 
 var log = logrus.WithField("component", "certwatcher")
 
-// certPollInterval defines how often the server and key are polled to see if they were updated.
+// certPollInterval is the default of how often the server and key are polled to see if they were updated.
 const certPollInterval = 60 * time.Second
 
-// Start instantiates pollwatcher & certinel and launches the monitoring of the
-// certificate and key. Returns the Certinel object.
-func Start(cert, key string) *certinel.Certinel {
+// Config configures a Watcher.
+type Config struct {
+	Cert string
+	Key  string
+	// MaxFailures is the number of consecutive reload failures after which
+	// the process exits, 0 never exits.
+	MaxFailures int
+	Watch       WatchConfig
+	// SNI lists additional certificates served to clients requesting one of
+	// their hostnames. Cert and Key remain the default.
+	SNI []KeyPair
+}
+
+// Watcher serves the last certificate that loaded successfully and records
+// the reload failures since then.
+type Watcher struct {
+	*certinel.Certinel
+
+	cert        string
+	key         string
+	maxFailures int
+
+	reloadTracker
+	// initial is the certificate loaded by Start, served until certinel
+	// receives its first one.
+	initial *tls.Certificate
+	// sni holds the additional certificates selected by SNI.
+	sni []*sniCert
+}
+
+// ReloadStatus describes the reloads of a watched file.
+type ReloadStatus struct {
+	LastReload          time.Time
+	LastFailure         time.Time
+	LastError           error
+	ConsecutiveFailures int
+}
+
+// err describes the status as an error for health checks.
+func (s ReloadStatus) err(what string) error {
+	if s.ConsecutiveFailures > 0 {
+		return fmt.Errorf("%s reload failed %d time(s) in a row, last at %s: %s",
+			what, s.ConsecutiveFailures, s.LastFailure.Format(time.RFC3339), s.LastError)
+	}
+	if s.LastReload.IsZero() {
+		return fmt.Errorf("no %s loaded yet", what)
+	}
+	return nil
+}
+
+// reloadTracker records the ReloadStatus of a watcher.
+type reloadTracker struct {
+	mu     sync.Mutex
+	status ReloadStatus
+}
+
+// Status returns the current reload status.
+func (t *reloadTracker) Status() ReloadStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status
+}
+
+// reloaded resets the failures and returns how many there were.
+func (t *reloadTracker) reloaded() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	failures := t.status.ConsecutiveFailures
+	t.status.LastReload = time.Now()
+	t.status.ConsecutiveFailures = 0
+	return failures
+}
+
+// failed records err and returns the number of consecutive failures.
+func (t *reloadTracker) failed(err error) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.LastFailure = time.Now()
+	t.status.LastError = err
+	t.status.ConsecutiveFailures++
+	return t.status.ConsecutiveFailures
+}
+
+// Start loads the certificate and key, and the SNI ones, then instantiates
+// certinel and launches their monitoring. It fails if any certificate cannot
+// be loaded. A failed reload keeps the previous certificate in use; the
+// process exits after MaxFailures consecutive failures.
+func Start(config Config) (*Watcher, error) {
+	w, err := start(config.Cert, config.Key, config)
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range config.SNI {
+		sw, err := start(pair.Cert, pair.Key, config)
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+		w.sni = append(w.sni, newSNICert(pair.Hostnames, sw))
+	}
+	return w, nil
+}
+
+func start(cert, key string, config Config) (*Watcher, error) {
+	w := &Watcher{
+		cert:        cert,
+		key:         key,
+		maxFailures: config.MaxFailures,
+	}
+	// Only the reloads are allowed to fail, a certificate that cannot be
+	// loaded at startup is fatal.
+	initial, err := loadKeyPair(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load certificate %s and key %s: %s", cert, key, err)
+	}
+	w.initial = &initial
+	w.reloaded()
+
+	n, err := newNotifier(config.Watch, cert, key)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("watching certificate %s and key %s (mode: %s)", cert, key, config.Watch.Mode)
 	// Setup certinel to watch for cert changes
-	watcher := pollwatcher.New(cert, key, certPollInterval)
-	c := certinel.New(watcher, log, func(err error) {
-		log.Fatalf("error: certinel was unable to reload the certificate (key: %s, cert: %s). err='%s'", key, cert, err)
+	s := newSentry(newFileWatcher(cert, key, n), w.recordReload)
+	w.Certinel = certinel.New(s, log, w.recordFailure)
+	w.Watch()
+	return w, nil
+}
+
+// current returns the certificate in use.
+func (w *Watcher) current() *tls.Certificate {
+	if cert, _ := w.Certinel.GetCertificate(nil); cert != nil {
+		return cert
+	}
+	return w.initial
+}
+
+// Close stops watching the default and SNI certificates.
+func (w *Watcher) Close() error {
+	err := w.Certinel.Close()
+	for _, c := range w.sni {
+		if cerr := c.watcher.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// HealthZ implements the healthz.HealthCheckable interface. It fails while
+// any certificate is not loaded or its latest reload attempt failed.
+func (w *Watcher) HealthZ() error {
+	var problems []string
+	if err := w.Status().err(fmt.Sprintf("certificate (key: %s, cert: %s)", w.key, w.cert)); err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, c := range w.sni {
+		if err := c.watcher.HealthZ(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (w *Watcher) recordReload() {
+	if failures := w.reloaded(); failures > 0 {
+		log.Infof("certificate reloaded after %d failure(s)", failures)
+	}
+}
+
+func (w *Watcher) recordFailure(err error) {
+	failures := w.failed(err)
+	log := log.WithError(err).WithFields(logrus.Fields{
+		"cert":                w.cert,
+		"key":                 w.key,
+		"consecutiveFailures": failures,
+	})
+	if w.maxFailures > 0 && failures >= w.maxFailures {
+		log.Fatal("certinel was unable to reload the certificate too many times")
+	}
+	log.Error("certinel was unable to reload the certificate, serving the previous one")
+}
+
+// fileWatcher is a certinel.Watcher loading the key pair every time the
+// notifier reports a change.
+type fileWatcher struct {
+	cert     string
+	key      string
+	notifier notifier
+	tlsChan  chan tls.Certificate
+	errChan  chan error
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newFileWatcher(cert, key string, n notifier) *fileWatcher {
+	return &fileWatcher{
+		cert:     cert,
+		key:      key,
+		notifier: n,
+		tlsChan:  make(chan tls.Certificate),
+		errChan:  make(chan error),
+		done:     make(chan struct{}),
+	}
+}
+
+// Watch implements certinel.Watcher.
+func (w *fileWatcher) Watch() (<-chan tls.Certificate, <-chan error) {
+	go func() {
+		for {
+			cert, err := loadKeyPair(w.cert, w.key)
+			if err != nil {
+				select {
+				case w.errChan <- err:
+				case <-w.done:
+					return
+				}
+			} else {
+				select {
+				case w.tlsChan <- cert:
+				case <-w.done:
+					return
+				}
+			}
+			select {
+			case <-w.notifier.C():
+			case <-w.done:
+				return
+			}
+		}
+	}()
+	return w.tlsChan, w.errChan
+}
+
+// Close implements certinel.Watcher.
+func (w *fileWatcher) Close() error {
+	var err error
+	w.once.Do(func() {
+		close(w.done)
+		err = w.notifier.Close()
+	})
+	return err
+}
+
+func loadKeyPair(cert, key string) (tls.Certificate, error) {
+	certificate, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return certificate, fmt.Errorf("error loading certificate: %s", err)
+	}
+	certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return certificate, fmt.Errorf("error parsing certificate: %s", err)
+	}
+	return certificate, nil
+}
+
+// sentry wraps a certinel.Watcher to report each certificate it loads. Its
+// channels are never closed, so that certinel does not read zero values from
+// them after Close.
+type sentry struct {
+	watcher certinel.Watcher
+	onLoad  func()
+	tlsChan chan tls.Certificate
+	errChan chan error
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newSentry(watcher certinel.Watcher, onLoad func()) *sentry {
+	return &sentry{
+		watcher: watcher,
+		onLoad:  onLoad,
+		tlsChan: make(chan tls.Certificate),
+		errChan: make(chan error),
+		done:    make(chan struct{}),
+	}
+}
+
+// Watch implements certinel.Watcher.
+func (s *sentry) Watch() (<-chan tls.Certificate, <-chan error) {
+	tlsChan, errChan := s.watcher.Watch()
+	go func() {
+		for {
+			select {
+			case cert, ok := <-tlsChan:
+				if !ok {
+					return
+				}
+				select {
+				case s.tlsChan <- cert:
+					s.onLoad()
+				case <-s.done:
+					return
+				}
+			case err, ok := <-errChan:
+				if !ok {
+					return
+				}
+				select {
+				case s.errChan <- err:
+				case <-s.done:
+					return
+				}
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return s.tlsChan, s.errChan
+}
+
+// Close implements certinel.Watcher.
+func (s *sentry) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.done)
+		err = s.watcher.Close()
 	})
-	c.Watch()
-	return c
+	return err
 }
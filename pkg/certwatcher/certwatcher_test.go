@@ -0,0 +1,264 @@
+package certwatcher
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pantheon-systems/certinel"
+)
+
+type fakeWatcher struct {
+	tlsChan chan tls.Certificate
+	errChan chan error
+}
+
+func (f *fakeWatcher) Watch() (<-chan tls.Certificate, <-chan error) {
+	return f.tlsChan, f.errChan
+}
+
+func (f *fakeWatcher) Close() error {
+	return nil
+}
+
+func TestReloadFailureKeepsCertificate(t *testing.T) {
+	fake := &fakeWatcher{
+		tlsChan: make(chan tls.Certificate),
+		errChan: make(chan error),
+	}
+	w := &Watcher{cert: "server.crt", key: "server.key"}
+	w.Certinel = certinel.New(newSentry(fake, w.recordReload), nil, w.recordFailure)
+	w.Watch()
+	defer w.Close()
+
+	if err := w.HealthZ(); err == nil {
+		t.Fatal("expected health check to fail before the first certificate is loaded")
+	}
+
+	fake.tlsChan <- tls.Certificate{Leaf: &x509.Certificate{Subject: pkix.Name{CommonName: "first"}}}
+	waitFor(t, func() bool { return w.HealthZ() == nil })
+
+	fake.errChan <- errors.New("bad PEM")
+	fake.errChan <- errors.New("bad PEM")
+	waitFor(t, func() bool { return w.Status().ConsecutiveFailures == 2 })
+	if err := w.HealthZ(); err == nil {
+		t.Fatal("expected health check to fail after a reload failure")
+	}
+	cert, _ := w.GetCertificate(nil)
+	if cert == nil || cert.Leaf.Subject.CommonName != "first" {
+		t.Fatalf("expected the previous certificate to be served, got: %+v", cert)
+	}
+
+	fake.tlsChan <- tls.Certificate{Leaf: &x509.Certificate{Subject: pkix.Name{CommonName: "second"}}}
+	waitFor(t, func() bool { return w.HealthZ() == nil })
+	if w.Status().ConsecutiveFailures != 0 {
+		t.Fatal("expected failures to reset after a successful reload")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatcherReloadsRewrittenFiles(t *testing.T) {
+	for _, mode := range []string{ModePoll, ModeFSNotify} {
+		t.Run(mode, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+			cert := filepath.Join(dir, "tls.crt")
+			key := filepath.Join(dir, "tls.key")
+			writeKeyPair(t, cert, key, "first")
+
+			w, err := Start(Config{
+				Cert:  cert,
+				Key:   key,
+				Watch: WatchConfig{Mode: mode, PollInterval: 10 * time.Millisecond},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			waitForCN(t, w, "first")
+
+			writeKeyPair(t, cert, key, "second")
+			waitForCN(t, w, "second")
+		})
+	}
+}
+
+// TestWatcherKubernetesSymlinkSwap mimics how the kubelet updates secret
+// volumes: the files are symlinks into ..data, which is itself a symlink
+// atomically renamed to point at a new timestamped directory.
+func TestWatcherKubernetesSymlinkSwap(t *testing.T) {
+	for _, mode := range []string{ModePoll, ModeFSNotify} {
+		t.Run(mode, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+			swapSecret(t, dir, "..2020_01_01", "first")
+			for _, name := range []string{"tls.crt", "tls.key"} {
+				if err := os.Symlink(filepath.Join("..data", name), filepath.Join(dir, name)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			w, err := Start(Config{
+				Cert:  filepath.Join(dir, "tls.crt"),
+				Key:   filepath.Join(dir, "tls.key"),
+				Watch: WatchConfig{Mode: mode, PollInterval: 10 * time.Millisecond},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			waitForCN(t, w, "first")
+
+			swapSecret(t, dir, "..2020_01_02", "second")
+			waitForCN(t, w, "second")
+		})
+	}
+}
+
+func TestStartUnknownMode(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	cert := filepath.Join(dir, "tls.crt")
+	key := filepath.Join(dir, "tls.key")
+	writeKeyPair(t, cert, key, "first")
+
+	_, err := Start(Config{Cert: cert, Key: key, Watch: WatchConfig{Mode: "inotify"}})
+	if err == nil {
+		t.Fatal("expected an error for an unknown watch mode")
+	}
+}
+
+func TestStartMissingCertificate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	cert := filepath.Join(dir, "tls.crt")
+	key := filepath.Join(dir, "tls.key")
+	writeKeyPair(t, cert, key, "first")
+	watch := WatchConfig{Mode: ModePoll, PollInterval: 10 * time.Millisecond}
+
+	_, err := Start(Config{Cert: filepath.Join(dir, "missing.crt"), Key: key, MaxFailures: 5, Watch: watch})
+	if err == nil {
+		t.Fatal("expected an error for a missing certificate")
+	}
+	_, err = Start(Config{
+		Cert:        cert,
+		Key:         key,
+		MaxFailures: 5,
+		Watch:       watch,
+		SNI:         []KeyPair{{Cert: filepath.Join(dir, "missing.crt"), Key: key}},
+	})
+	if err == nil {
+		t.Fatal("expected an error for a missing SNI certificate")
+	}
+}
+
+func TestStartServesCertificate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	cert := filepath.Join(dir, "tls.crt")
+	key := filepath.Join(dir, "tls.key")
+	writeKeyPair(t, cert, key, "first")
+
+	w, err := Start(Config{Cert: cert, Key: key, Watch: WatchConfig{Mode: ModePoll, PollInterval: time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	// No waiting: the certificate is served as soon as Start returns.
+	if c, _ := w.GetCertificate(nil); c == nil || c.Leaf.Subject.CommonName != "first" {
+		t.Fatalf("expected the certificate to be served once started, got: %+v", c)
+	}
+	if err := w.HealthZ(); err != nil {
+		t.Fatalf("expected the certificate to be loaded once started: %s", err)
+	}
+}
+
+// swapSecret writes a key pair into a new data directory and atomically
+// points the ..data symlink at it.
+func swapSecret(t *testing.T, dir, dataDir, cn string) {
+	t.Helper()
+	if err := os.Mkdir(filepath.Join(dir, dataDir), 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeKeyPair(t, filepath.Join(dir, dataDir, "tls.crt"), filepath.Join(dir, dataDir, "tls.key"), cn)
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(dataDir, tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitForCN(t *testing.T, w *Watcher, cn string) {
+	t.Helper()
+	waitFor(t, func() bool {
+		cert, _ := w.GetCertificate(nil)
+		return cert != nil && cert.Leaf.Subject.CommonName == cn
+	})
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "certwatcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// writeKeyPair writes a self-signed certificate for cn and its key. The key is
+// written first, so that a watcher reacting to the certificate change loads
+// a matching pair.
+func writeKeyPair(t *testing.T, certFile, keyFile, cn string) {
+	t.Helper()
+	writeKeyPairExpiring(t, certFile, keyFile, cn, time.Now().Add(time.Hour))
+}
+
+// writeKeyPairExpiring writes a self-signed key pair for cn valid until
+// notAfter.
+func writeKeyPairExpiring(t *testing.T, certFile, keyFile, cn string, notAfter time.Time) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
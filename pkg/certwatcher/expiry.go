@@ -0,0 +1,170 @@
+package certwatcher
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pantheon-systems/go-demo-service/pkg/appmetrics"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// DefaultExpiryCheckInterval is used when ExpiryConfig.Interval is not
+// positive.
+const DefaultExpiryCheckInterval = time.Hour
+
+// ExpiryConfig configures an ExpiryMonitor.
+type ExpiryConfig struct {
+	// GetCertificate returns the served certificate, e.g. Watcher.GetCertificate.
+	GetCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	// SNICertificates returns the certificates served through SNI, e.g.
+	// Watcher.SNICertificates.
+	SNICertificates func() []SNICertificate
+	// CACerts returns the trusted CA certificates.
+	CACerts func() []*x509.Certificate
+	// Threshold is the remaining validity under which the health check fails.
+	Threshold time.Duration
+	// Interval defines how often the gauges are refreshed by Run, defaults
+	// to DefaultExpiryCheckInterval.
+	Interval time.Duration
+	// Registry receives the gauges, defaults to metrics.DefaultRegistry.
+	Registry metrics.Registry
+}
+
+// ExpiryMonitor publishes the days until the served and CA certificates
+// expire, and fails its health check when any gets below the threshold. The
+// SNI certificates are published as `cert_expiry.sni.days`, tagged with
+// their server name.
+type ExpiryMonitor struct {
+	config     ExpiryConfig
+	serverDays metrics.Gauge
+	caDays     metrics.Gauge
+}
+
+// NewExpiryMonitor registers the expiry gauges.
+func NewExpiryMonitor(config ExpiryConfig) *ExpiryMonitor {
+	if config.Registry == nil {
+		config.Registry = metrics.DefaultRegistry
+	}
+	if config.CACerts == nil {
+		config.CACerts = func() []*x509.Certificate { return nil }
+	}
+	if config.SNICertificates == nil {
+		config.SNICertificates = func() []SNICertificate { return nil }
+	}
+	if config.Interval <= 0 {
+		log.Warnf("invalid certificate expiry check interval %s, using %s", config.Interval, DefaultExpiryCheckInterval)
+		config.Interval = DefaultExpiryCheckInterval
+	}
+	return &ExpiryMonitor{
+		config:     config,
+		serverDays: metrics.GetOrRegisterGauge("cert_expiry.server.days", config.Registry),
+		caDays:     metrics.GetOrRegisterGauge("cert_expiry.ca.days", config.Registry),
+	}
+}
+
+// Run refreshes the gauges every Interval until ctx is done.
+func (m *ExpiryMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+	for {
+		if err := m.check(); err != nil {
+			log.WithError(err).Warn("certificate expiry check failed")
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// HealthZ implements the healthz.HealthCheckable interface.
+func (m *ExpiryMonitor) HealthZ() error {
+	return m.check()
+}
+
+// check updates the gauges and returns an error if a certificate expires
+// within the threshold.
+func (m *ExpiryMonitor) check() error {
+	now := time.Now()
+	var problems []string
+
+	cert, _ := m.config.GetCertificate(nil)
+	if cert == nil || cert.Leaf == nil {
+		problems = append(problems, "no server certificate loaded")
+	} else {
+		remaining := cert.Leaf.NotAfter.Sub(now)
+		m.serverDays.Update(int64(remaining / (24 * time.Hour)))
+		if remaining < m.config.Threshold {
+			problems = append(problems, fmt.Sprintf("server certificate %q expires at %s",
+				cert.Leaf.Subject.CommonName, cert.Leaf.NotAfter.Format(time.RFC3339)))
+		}
+	}
+
+	for _, sni := range m.config.SNICertificates() {
+		leaf := sni.Certificate.Leaf
+		remaining := leaf.NotAfter.Sub(now)
+		days := appmetrics.GetOrRegisterGauge("cert_expiry.sni.days", appmetrics.Tags{"server_name": sni.ServerName}, m.config.Registry)
+		days.Update(int64(remaining / (24 * time.Hour)))
+		if remaining < m.config.Threshold {
+			problems = append(problems, fmt.Sprintf("SNI certificate for %q expires at %s",
+				sni.ServerName, leaf.NotAfter.Format(time.RFC3339)))
+		}
+	}
+
+	// The CA gauge tracks the certificate of the bundle that expires first.
+	caCerts := m.config.CACerts()
+	var minRemaining time.Duration
+	for i, ca := range caCerts {
+		remaining := ca.NotAfter.Sub(now)
+		if i == 0 || remaining < minRemaining {
+			minRemaining = remaining
+		}
+		if remaining < m.config.Threshold {
+			problems = append(problems, fmt.Sprintf("CA certificate %q expires at %s",
+				ca.Subject.CommonName, ca.NotAfter.Format(time.RFC3339)))
+		}
+	}
+	if len(caCerts) > 0 {
+		m.caDays.Update(int64(minRemaining / (24 * time.Hour)))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("certificates expire within %s: %s", m.config.Threshold, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// LoadCACerts parses every certificate of a PEM CA bundle.
+func LoadCACerts(path string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not load CA certificates: %s", err)
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse CA certificate: %s", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no CA certificates found in %s", path)
+	}
+	return certs, nil
+}
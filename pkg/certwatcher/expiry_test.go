@@ -0,0 +1,122 @@
+package certwatcher
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+func TestExpiryMonitor(t *testing.T) {
+	leaf := &x509.Certificate{NotAfter: time.Now().Add(30*24*time.Hour + time.Hour)}
+	caCerts := []*x509.Certificate{
+		{NotAfter: time.Now().Add(365 * 24 * time.Hour)},
+		{NotAfter: time.Now().Add(90*24*time.Hour + time.Hour)},
+	}
+	registry := metrics.NewRegistry()
+	m := NewExpiryMonitor(ExpiryConfig{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &tls.Certificate{Leaf: leaf}, nil
+		},
+		CACerts:   func() []*x509.Certificate { return caCerts },
+		Threshold: 14 * 24 * time.Hour,
+		Registry:  registry,
+	})
+
+	if err := m.HealthZ(); err != nil {
+		t.Fatalf("expected healthy certificates, got: %s", err)
+	}
+	if days := registry.Get("cert_expiry.server.days").(metrics.Gauge).Value(); days != 30 {
+		t.Fatalf("expected 30 days until the server certificate expires, got: %d", days)
+	}
+	if days := registry.Get("cert_expiry.ca.days").(metrics.Gauge).Value(); days != 90 {
+		t.Fatalf("expected 90 days until the first CA certificate expires, got: %d", days)
+	}
+
+	leaf.NotAfter = time.Now().Add(7 * 24 * time.Hour)
+	if err := m.HealthZ(); err == nil {
+		t.Fatal("expected health check to fail for a server certificate expiring within the threshold")
+	}
+}
+
+func TestExpiryMonitorSNI(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	day := 24 * time.Hour
+	writeKeyPairExpiring(t, filepath.Join(dir, "default.crt"), filepath.Join(dir, "default.key"), "default.example.com", time.Now().Add(90*day+time.Hour))
+	writeKeyPairExpiring(t, filepath.Join(dir, "api.crt"), filepath.Join(dir, "api.key"), "api.example.com", time.Now().Add(60*day+time.Hour))
+	writeKeyPairExpiring(t, filepath.Join(dir, "internal.crt"), filepath.Join(dir, "internal.key"), "internal", time.Now().Add(10*day+time.Hour))
+
+	w, err := Start(Config{
+		Cert: filepath.Join(dir, "default.crt"),
+		Key:  filepath.Join(dir, "default.key"),
+		SNI: []KeyPair{
+			{Cert: filepath.Join(dir, "api.crt"), Key: filepath.Join(dir, "api.key")},
+			{Cert: filepath.Join(dir, "internal.crt"), Key: filepath.Join(dir, "internal.key"), Hostnames: []string{"*.Internal.example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	registry := metrics.NewRegistry()
+	m := NewExpiryMonitor(ExpiryConfig{
+		GetCertificate:  w.GetCertificate,
+		SNICertificates: w.SNICertificates,
+		Threshold:       14 * day,
+		Registry:        registry,
+	})
+	err = m.HealthZ()
+	if err == nil || !strings.Contains(err.Error(), `"*.internal.example.com"`) {
+		t.Fatalf("expected health check to fail for the SNI certificate expiring within the threshold, got: %v", err)
+	}
+	tests := map[string]int64{
+		"cert_expiry.server.days":                                 90,
+		"cert_expiry.sni.days;server_name=api.example.com":        60,
+		"cert_expiry.sni.days;server_name=*.internal.example.com": 10,
+	}
+	for name, want := range tests {
+		g, ok := registry.Get(name).(metrics.Gauge)
+		if !ok {
+			t.Errorf("expected a gauge %s", name)
+			continue
+		}
+		if g.Value() != want {
+			t.Errorf("%s: expected %d days, got %d", name, want, g.Value())
+		}
+	}
+}
+
+func TestExpiryMonitorZeroInterval(t *testing.T) {
+	leaf := &x509.Certificate{NotAfter: time.Now().Add(30 * 24 * time.Hour)}
+	m := NewExpiryMonitor(ExpiryConfig{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &tls.Certificate{Leaf: leaf}, nil
+		},
+		Registry: metrics.NewRegistry(),
+	})
+	if m.config.Interval != DefaultExpiryCheckInterval {
+		t.Fatalf("expected the default interval, got: %s", m.config.Interval)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// Would panic on a zero ticker interval.
+	m.Run(ctx)
+}
+
+func TestLoadCACerts(t *testing.T) {
+	certs, err := LoadCACerts("../../test-fixtures/certs/ca.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 || certs[0].Subject.CommonName != "test-CA" {
+		t.Fatalf("unexpected CA certificates: %v", certs)
+	}
+}
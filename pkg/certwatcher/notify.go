@@ -0,0 +1,209 @@
+package certwatcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch modes selecting how certificate files are watched.
+const (
+	// ModePoll stats the files every PollInterval.
+	ModePoll = "poll"
+	// ModeFSNotify watches the parent directories of the files for events,
+	// which also catches Kubernetes' atomic symlink swap of secret volumes.
+	ModeFSNotify = "fsnotify"
+)
+
+// WatchConfig selects how certificate files are watched for changes.
+type WatchConfig struct {
+	Mode         string
+	PollInterval time.Duration
+}
+
+// notifier signals on C whenever one of the watched files changed, until
+// Done is closed by Close.
+type notifier interface {
+	C() <-chan struct{}
+	Done() <-chan struct{}
+	Close() error
+}
+
+func newNotifier(config WatchConfig, paths ...string) (notifier, error) {
+	switch config.Mode {
+	case ModePoll, "":
+		if config.PollInterval <= 0 {
+			config.PollInterval = certPollInterval
+		}
+		return newPollNotifier(config.PollInterval, paths), nil
+	case ModeFSNotify:
+		return newFSNotifier(paths)
+	default:
+		return nil, fmt.Errorf("unknown cert watch mode %q, expected %q or %q", config.Mode, ModePoll, ModeFSNotify)
+	}
+}
+
+// fileState identifies a version of a file. Target follows symlinks, so that
+// swapping a symlink to a file with the same size and mtime is still seen.
+type fileState struct {
+	target  string
+	size    int64
+	modTime time.Time
+	err     string
+}
+
+func statFiles(paths []string) []fileState {
+	states := make([]fileState, len(paths))
+	for i, path := range paths {
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			states[i].err = err.Error()
+			continue
+		}
+		stat, err := os.Stat(target)
+		if err != nil {
+			states[i].err = err.Error()
+			continue
+		}
+		states[i] = fileState{target: target, size: stat.Size(), modTime: stat.ModTime()}
+	}
+	return states
+}
+
+func sameStates(a, b []fileState) bool {
+	for i := range a {
+		if a[i].target != b[i].target || a[i].size != b[i].size ||
+			!a[i].modTime.Equal(b[i].modTime) || a[i].err != b[i].err {
+			return false
+		}
+	}
+	return true
+}
+
+// changeTracker signals on its channel when the files differ from the last
+// time they were checked.
+type changeTracker struct {
+	paths  []string
+	last   []fileState
+	c      chan struct{}
+	done   chan struct{}
+	closed sync.Once
+}
+
+func newChangeTracker(paths []string) *changeTracker {
+	return &changeTracker{
+		paths: paths,
+		last:  statFiles(paths),
+		c:     make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+}
+
+func (t *changeTracker) C() <-chan struct{} {
+	return t.c
+}
+
+func (t *changeTracker) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *changeTracker) check() {
+	states := statFiles(t.paths)
+	if sameStates(states, t.last) {
+		return
+	}
+	t.last = states
+	// Coalesce with a pending signal, the receiver reloads everything anyway.
+	select {
+	case t.c <- struct{}{}:
+	default:
+	}
+}
+
+func (t *changeTracker) stop() {
+	t.closed.Do(func() { close(t.done) })
+}
+
+type pollNotifier struct {
+	*changeTracker
+}
+
+func newPollNotifier(interval time.Duration, paths []string) *pollNotifier {
+	n := &pollNotifier{newChangeTracker(paths)}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				n.check()
+			case <-n.done:
+				return
+			}
+		}
+	}()
+	return n
+}
+
+func (n *pollNotifier) Close() error {
+	n.stop()
+	return nil
+}
+
+type fsNotifier struct {
+	*changeTracker
+	watcher *fsnotify.Watcher
+}
+
+func newFSNotifier(paths []string) (*fsNotifier, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("could not create fsnotify watcher: %s", err)
+	}
+	// Watch the directories rather than the files: a file replaced by a
+	// rename or a symlink swap would otherwise drop out of the watch.
+	dirs := map[string]bool{}
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("could not watch %s: %s", dir, err)
+		}
+	}
+	n := &fsNotifier{
+		changeTracker: newChangeTracker(paths),
+		watcher:       watcher,
+	}
+	go func() {
+		for {
+			select {
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				n.check()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.WithError(err).Warn("fsnotify watcher error")
+			case <-n.done:
+				return
+			}
+		}
+	}()
+	return n, nil
+}
+
+func (n *fsNotifier) Close() error {
+	n.stop()
+	return n.watcher.Close()
+}
@@ -0,0 +1,105 @@
+package certwatcher
+
+import (
+	"crypto/tls"
+	"strings"
+)
+
+// KeyPair is a certificate served to clients requesting one of Hostnames
+// through SNI. Without Hostnames, the DNS SANs of the certificate are used.
+type KeyPair struct {
+	Cert      string   `mapstructure:"cert"`
+	Key       string   `mapstructure:"key"`
+	Hostnames []string `mapstructure:"hostnames"`
+}
+
+type sniCert struct {
+	hostnames []string
+	watcher   *Watcher
+}
+
+func newSNICert(hostnames []string, w *Watcher) *sniCert {
+	c := &sniCert{watcher: w}
+	for _, h := range hostnames {
+		c.hostnames = append(c.hostnames, strings.ToLower(h))
+	}
+	return c
+}
+
+// SNICertificate is a certificate served through SNI, named after the first
+// server name it is served for.
+type SNICertificate struct {
+	ServerName  string
+	Certificate *tls.Certificate
+}
+
+// SNICertificates returns the current SNI certificates, without the default
+// one.
+func (w *Watcher) SNICertificates() []SNICertificate {
+	var certs []SNICertificate
+	for _, c := range w.sni {
+		cert := c.watcher.current()
+		if cert == nil || cert.Leaf == nil {
+			continue
+		}
+		certs = append(certs, SNICertificate{ServerName: c.serverName(cert), Certificate: cert})
+	}
+	return certs
+}
+
+// serverName names the certificate after its first hostname, or its first
+// DNS SAN when served for its SANs.
+func (c *sniCert) serverName(cert *tls.Certificate) string {
+	switch {
+	case len(c.hostnames) > 0:
+		return c.hostnames[0]
+	case len(cert.Leaf.DNSNames) > 0:
+		return strings.ToLower(cert.Leaf.DNSNames[0])
+	}
+	return cert.Leaf.Subject.CommonName
+}
+
+// GetCertificate returns the certificate matching the SNI server name of the
+// client hello, or the default certificate. It can be passed as the
+// GetCertificate member in a tls.Config object.
+func (w *Watcher) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if hello != nil && hello.ServerName != "" {
+		serverName := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+		for _, c := range w.sni {
+			if cert := c.match(serverName); cert != nil {
+				return cert, nil
+			}
+		}
+	}
+	return w.current(), nil
+}
+
+// match returns the current certificate if it is served for serverName.
+func (c *sniCert) match(serverName string) *tls.Certificate {
+	cert := c.watcher.current()
+	if cert == nil || cert.Leaf == nil {
+		return nil
+	}
+	if len(c.hostnames) == 0 {
+		if cert.Leaf.VerifyHostname(serverName) == nil {
+			return cert
+		}
+		return nil
+	}
+	for _, h := range c.hostnames {
+		if matchHostname(h, serverName) {
+			return cert
+		}
+	}
+	return nil
+}
+
+// matchHostname matches serverName against a hostname, which may start with
+// a "*." wildcard covering exactly one label.
+func matchHostname(hostname, serverName string) bool {
+	if strings.HasPrefix(hostname, "*.") {
+		i := strings.Index(serverName, ".")
+		return i > 0 && serverName[i:] == hostname[1:]
+	}
+	return hostname == serverName
+}
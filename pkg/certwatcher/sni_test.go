@@ -0,0 +1,58 @@
+package certwatcher
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWatcherSNI(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	for _, cn := range []string{"default.example.com", "api.example.com", "internal"} {
+		writeKeyPair(t, filepath.Join(dir, cn+".crt"), filepath.Join(dir, cn+".key"), cn)
+	}
+
+	w, err := Start(Config{
+		Cert: filepath.Join(dir, "default.example.com.crt"),
+		Key:  filepath.Join(dir, "default.example.com.key"),
+		SNI: []KeyPair{
+			{
+				Cert: filepath.Join(dir, "api.example.com.crt"),
+				Key:  filepath.Join(dir, "api.example.com.key"),
+			},
+			{
+				Cert:      filepath.Join(dir, "internal.crt"),
+				Key:       filepath.Join(dir, "internal.key"),
+				Hostnames: []string{"*.Internal.example.com"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	waitFor(t, func() bool { return w.HealthZ() == nil })
+
+	tests := []struct {
+		serverName string
+		want       string
+	}{
+		{"", "default.example.com"},
+		{"unknown.example.com", "default.example.com"},
+		{"api.example.com", "api.example.com"},
+		{"API.example.com.", "api.example.com"},
+		{"db.internal.example.com", "internal"},
+		{"a.db.internal.example.com", "default.example.com"},
+	}
+	for _, tt := range tests {
+		cert, err := w.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.serverName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cert.Leaf.Subject.CommonName; got != tt.want {
+			t.Errorf("server name %q: want certificate %q, got: %q", tt.serverName, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package healthz
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultHistorySize is the number of results kept per provider when
+// Config.HistorySize is not set.
+const DefaultHistorySize = 20
+
+// resultCache holds the results of the latest background check run.
+type resultCache struct {
+	mu        sync.RWMutex
+	results   []checkResult
+	checkedAt time.Time
+}
+
+func (c *resultCache) set(results []checkResult, checkedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results = results
+	c.checkedAt = checkedAt
+}
+
+func (c *resultCache) get() ([]checkResult, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.results, c.checkedAt
+}
+
+// RunChecks runs all checks every CheckInterval until ctx is done, so that
+// the handlers serve cached results. It should be run in a new goroutine.
+func (h *HealthChecker) RunChecks(ctx context.Context) {
+	if h.CheckInterval <= 0 {
+		log.Debug("No healthz check interval, checks run on each request")
+		return
+	}
+	ticker := time.NewTicker(h.CheckInterval)
+	defer ticker.Stop()
+	for {
+		checkedAt := time.Now()
+		h.cache.set(h.runChecks(ctx, 0), checkedAt)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// results returns the results of the providers taking part in probe, or all
+// of them if probe is 0, and the time cached results were checked at. Cached
+// results are served with their age in the Age header; checks are run for the
+// request until the cache is populated, with a zero check time.
+func (h *HealthChecker) results(w http.ResponseWriter, r *http.Request, probe Probe) ([]checkResult, time.Time) {
+	cached, checkedAt := h.cache.get()
+	if checkedAt.IsZero() {
+		return h.runChecks(r.Context(), probe), checkedAt
+	}
+	w.Header().Set("Age", strconv.Itoa(int(time.Since(checkedAt).Seconds())))
+	var results []checkResult
+	for _, result := range cached {
+		if probe == 0 || result.Provider.Probes&probe != 0 {
+			results = append(results, result)
+		}
+	}
+	return results, checkedAt
+}
+
+// cachedAt returns a pointer to checkedAt for the response bodies, nil for
+// results checked for the request.
+func cachedAt(checkedAt time.Time) *time.Time {
+	if checkedAt.IsZero() {
+		return nil
+	}
+	return &checkedAt
+}
+
+// HistoryEntry is a past result of a provider check.
+type HistoryEntry struct {
+	Time     time.Time
+	Duration string
+	Status   string
+	Error    *Error `json:",omitempty"`
+}
+
+// ProviderHistory lists the recent results of a provider, newest first.
+type ProviderHistory struct {
+	Type        string
+	Description string
+	Results     []HistoryEntry
+}
+
+// HistoryResponse is the body of `/healthz/history`.
+type HistoryResponse struct {
+	Providers []ProviderHistory
+	Hostname  string
+}
+
+// HandleHistory is the http handler for `/healthz/history`.
+func (h *HealthChecker) HandleHistory(w http.ResponseWriter, r *http.Request) {
+	resp := &HistoryResponse{
+		Hostname: h.Hostname,
+	}
+	for i, provider := range h.Providers {
+		resp.Providers = append(resp.Providers, ProviderHistory{
+			Type:        provider.Type,
+			Description: provider.Description,
+			Results:     h.history[i].list(),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// history is a ring buffer of the recent results of a provider.
+type history struct {
+	mu      sync.Mutex
+	entries []HistoryEntry
+	next    int
+	full    bool
+}
+
+func newHistory(size int) *history {
+	return &history{entries: make([]HistoryEntry, size)}
+}
+
+func (hs *history) add(result checkResult) {
+	entry := HistoryEntry{
+		Time:     result.Time,
+		Duration: result.Duration.String(),
+		Status:   StatusOK,
+		Error:    result.Err,
+	}
+	if result.Err != nil {
+		entry.Status = StatusFail
+	}
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.entries[hs.next] = entry
+	hs.next = (hs.next + 1) % len(hs.entries)
+	if hs.next == 0 {
+		hs.full = true
+	}
+}
+
+// list returns the entries, newest first.
+func (hs *history) list() []HistoryEntry {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	n := hs.next
+	if hs.full {
+		n = len(hs.entries)
+	}
+	list := make([]HistoryEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		list = append(list, hs.entries[(hs.next-i+len(hs.entries))%len(hs.entries)])
+	}
+	return list
+}
@@ -0,0 +1,128 @@
+package healthz
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestCachedChecks(t *testing.T) {
+	counter := &Counter{}
+	cfg := config
+	cfg.CheckInterval = time.Hour
+	cfg.Providers = []ProviderInfo{
+		ProviderInfo{
+			Check:  counter,
+			Type:   "Counter",
+			Probes: Readiness,
+		},
+	}
+	hz, err := New(cfg)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// Checks run on each request until the background run populated the cache.
+	probeRequest(t, hz, "/healthz")
+	if n := atomic.LoadInt32(&counter.calls); n != 1 {
+		t.Fatal("Expected 1 check before the cache is populated, got:", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hz.RunChecks(ctx)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&counter.calls) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the background checks")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Wait for the results to be stored.
+	for _, checkedAt := hz.cache.get(); checkedAt.IsZero(); _, checkedAt = hz.cache.get() {
+		time.Sleep(time.Millisecond)
+	}
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		w := probeRequest(t, hz, path)
+		if w.Code != 200 {
+			t.Fatal("Expected 200 OK, got:", w.Code)
+		}
+		if w.Header().Get("Age") != "0" {
+			t.Fatalf("Expected the age of the cached results, got: %q", w.Header().Get("Age"))
+		}
+		var body struct {
+			CheckedAt *time.Time
+		}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if _, checkedAt := hz.cache.get(); body.CheckedAt == nil || !body.CheckedAt.Equal(checkedAt) {
+			t.Fatalf("Expected the time of the cached results %s in the body, got: %v", checkedAt, body.CheckedAt)
+		}
+	}
+	if n := atomic.LoadInt32(&counter.calls); n != 2 {
+		t.Fatal("Expected cached results to be served without running checks, got calls:", n)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	counter := &Counter{failEvery: 2}
+	cfg := config
+	cfg.HistorySize = 3
+	cfg.Providers = []ProviderInfo{
+		ProviderInfo{
+			Check:       counter,
+			Type:        "Counter",
+			Description: "Fails every other call",
+		},
+	}
+	hz, err := New(cfg)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for i := 0; i < 4; i++ {
+		probeRequest(t, hz, "/healthz")
+	}
+
+	w := probeRequest(t, hz, "/healthz/history")
+	if w.Code != 200 {
+		t.Fatal("Expected 200 OK, got:", w.Code)
+	}
+	var resp HistoryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(resp.Providers) != 1 || resp.Providers[0].Type != "Counter" {
+		t.Fatal("Unexpected providers in history:", w.Body.String())
+	}
+	var statuses []string
+	for _, entry := range resp.Providers[0].Results {
+		statuses = append(statuses, entry.Status)
+	}
+	// Calls 2 and 4 fail; only the 3 most recent are kept, newest first.
+	if len(statuses) != 3 || statuses[0] != StatusFail || statuses[1] != StatusOK || statuses[2] != StatusFail {
+		t.Fatal("Unexpected history, got:", statuses)
+	}
+	if resp.Providers[0].Results[0].Error.ErrMsg != "call 4 failed" {
+		t.Fatal("Unexpected error in history, got:", resp.Providers[0].Results[0].Error)
+	}
+}
+
+// Counter counts its calls, and fails every failEvery calls if set.
+type Counter struct {
+	calls     int32
+	failEvery int32
+}
+
+func (hz *Counter) HealthZ() error {
+	n := atomic.AddInt32(&hz.calls, 1)
+	if hz.failEvery > 0 && n%hz.failEvery == 0 {
+		return errors.Errorf("call %d failed", n)
+	}
+	return nil
+}
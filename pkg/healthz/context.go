@@ -0,0 +1,41 @@
+package healthz
+
+import "context"
+
+// HealthCheckableContext is implemented by checks that can be cancelled. The
+// context is cancelled when the provider timeout expires or the client of
+// the health check goes away.
+type HealthCheckableContext interface {
+	HealthZContext(ctx context.Context) error
+}
+
+// contextChecker returns the context-aware check of a provider. A Check that
+// only implements HealthCheckable is adapted, its HealthZ() keeps running in
+// the background if the context is cancelled first.
+func (p ProviderInfo) contextChecker() HealthCheckableContext {
+	if p.CheckContext != nil {
+		return p.CheckContext
+	}
+	if c, ok := p.Check.(HealthCheckableContext); ok {
+		return c
+	}
+	return checkableAdapter{p.Check}
+}
+
+type checkableAdapter struct {
+	HealthCheckable
+}
+
+func (a checkableAdapter) HealthZContext(ctx context.Context) error {
+	// Buffered, so that a check finishing after the context does not block.
+	result := make(chan error, 1)
+	go func() {
+		result <- a.HealthZ()
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
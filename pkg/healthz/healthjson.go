@@ -0,0 +1,129 @@
+package healthz
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HealthJSONMediaType is the media type of the health check response format
+// of https://tools.ietf.org/html/draft-inadarei-api-health-check.
+const HealthJSONMediaType = "application/health+json"
+
+// Statuses of the health+json format.
+const (
+	HealthPass = "pass"
+	HealthWarn = "warn"
+	HealthFail = "fail"
+)
+
+// HealthJSONResponse is the health+json body of `/healthz`.
+type HealthJSONResponse struct {
+	Status    string                       `json:"status"`
+	Version   string                       `json:"version,omitempty"`
+	ServiceID string                       `json:"serviceId,omitempty"`
+	Checks    map[string][]HealthJSONCheck `json:"checks"`
+}
+
+// HealthJSONCheck is the result of a provider check, keyed by
+// `<Type>:responseTime` in HealthJSONResponse.Checks. The observed value is
+// the check duration.
+type HealthJSONCheck struct {
+	ComponentID   string    `json:"componentId,omitempty"`
+	ComponentType string    `json:"componentType"`
+	ObservedValue float64   `json:"observedValue"`
+	ObservedUnit  string    `json:"observedUnit"`
+	Status        string    `json:"status"`
+	Time          time.Time `json:"time"`
+	Output        string    `json:"output,omitempty"`
+}
+
+// acceptsHealthJSON reports whether the Accept header of r asks for the
+// health+json format.
+func acceptsHealthJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err != nil {
+				continue
+			}
+			if mediaType == HealthJSONMediaType && acceptable(params["q"]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// acceptable reports whether the quality value q of a media range is not 0,
+// which rejects the media type. A missing q defaults to 1.
+func acceptable(q string) bool {
+	if q == "" {
+		return true
+	}
+	weight, err := strconv.ParseFloat(strings.TrimSpace(q), 64)
+	return err == nil && weight > 0
+}
+
+// healthJSONResponse builds the health+json body of results. Failing Warning
+// providers make the status warn, failing Critical ones make it fail. The
+// component ID and check output are left out if redact is set.
+func (h *HealthChecker) healthJSONResponse(results []checkResult, redact bool) *HealthJSONResponse {
+	resp := &HealthJSONResponse{
+		Status:    HealthPass,
+		Version:   h.Version,
+		ServiceID: h.ServiceID,
+		Checks:    map[string][]HealthJSONCheck{},
+	}
+	for _, result := range results {
+		check := HealthJSONCheck{
+			ComponentID:   h.Hostname,
+			ComponentType: "component",
+			ObservedValue: float64(result.Duration) / float64(time.Millisecond),
+			ObservedUnit:  "ms",
+			Status:        HealthPass,
+			Time:          result.Time,
+		}
+		if redact {
+			check.ComponentID = ""
+		}
+		if result.Err != nil {
+			if !redact {
+				check.Output = result.Err.ErrMsg
+			}
+			check.Status = HealthFail
+			if result.Provider.Criticality == Warning {
+				check.Status = HealthWarn
+			}
+		}
+		switch {
+		case check.Status == HealthFail:
+			resp.Status = HealthFail
+		case check.Status == HealthWarn && resp.Status == HealthPass:
+			resp.Status = HealthWarn
+		}
+		key := result.Provider.Type + ":responseTime"
+		resp.Checks[key] = append(resp.Checks[key], check)
+	}
+	return resp
+}
+
+// writeHealthJSON writes the health+json body of results. Unlike the legacy
+// format, a failing status is answered with `503 Service Unavailable` as the
+// format requires.
+func (h *HealthChecker) writeHealthJSON(w http.ResponseWriter, results []checkResult, redact bool) {
+	resp := h.healthJSONResponse(results, redact)
+	w.Header().Set("Content-Type", HealthJSONMediaType)
+	if resp.Status == HealthFail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	err := json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,130 @@
+package healthz
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func healthJSONRequest(t *testing.T, hz *HealthChecker, accept string) (*httptest.ResponseRecorder, *HealthJSONResponse) {
+	req, err := http.NewRequest("GET", "/healthz", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	req.Header.Set("Accept", accept)
+	w := httptest.NewRecorder()
+	hz.Server.Handler.ServeHTTP(w, req)
+	if w.Header().Get("Content-Type") != HealthJSONMediaType {
+		t.Fatal("Expected health+json content type, got:", w.Header().Get("Content-Type"))
+	}
+	resp := &HealthJSONResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+		t.Fatal(err.Error())
+	}
+	return w, resp
+}
+
+func TestHealthJSON(t *testing.T) {
+	cfg := config
+	cfg.Version = "1.2.3"
+	cfg.ServiceID = "demo"
+	cfg.Providers = []ProviderInfo{
+		ProviderInfo{
+			Check: &Happy{},
+			Type:  "App",
+		},
+		ProviderInfo{
+			Check:       &Unhappy{},
+			Type:        "CertExpiry",
+			Criticality: Warning,
+		},
+	}
+	hz, err := New(cfg)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	w, resp := healthJSONRequest(t, hz, "application/json, application/health+json;q=0.9")
+	if w.Code != 200 {
+		t.Fatal("Expected 200 OK, got:", w.Code)
+	}
+	if resp.Status != HealthWarn || resp.Version != "1.2.3" || resp.ServiceID != "demo" {
+		t.Fatalf("Unexpected response: %+v", resp)
+	}
+	app := resp.Checks["App:responseTime"]
+	if len(app) != 1 || app[0].Status != HealthPass || app[0].ObservedUnit != "ms" || app[0].ComponentID != "tester" || app[0].Time.IsZero() {
+		t.Fatalf("Unexpected App check: %+v", app)
+	}
+	expiry := resp.Checks["CertExpiry:responseTime"]
+	if len(expiry) != 1 || expiry[0].Status != HealthWarn || expiry[0].Output != "failed" {
+		t.Fatalf("Unexpected CertExpiry check: %+v", expiry)
+	}
+
+	cfg.Providers[1].Criticality = Critical
+	hz, err = New(cfg)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	w, resp = healthJSONRequest(t, hz, "application/health+json")
+	if w.Code != 503 {
+		t.Fatal("Expected 503 Service Unavailable, got:", w.Code)
+	}
+	if resp.Status != HealthFail {
+		t.Fatal("Expected fail status, got:", resp.Status)
+	}
+}
+
+func TestHealthJSONNotAccepted(t *testing.T) {
+	config.Providers = []ProviderInfo{
+		ProviderInfo{
+			Check: &Unhappy{},
+			Type:  "DBConn",
+		},
+	}
+	hz, err := New(config)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, accept := range []string{"", "application/json", "application/health+json;q=0", "application/health+json;q=0.0", "application/health+json; q=0.000 ", "application/health+json;q=x"} {
+		req, err := http.NewRequest("GET", "/healthz", nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		hz.Server.Handler.ServeHTTP(w, req)
+		if w.Code != 200 || w.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("Expected the legacy format for Accept %q, got: %d %s", accept, w.Code, w.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestHealthJSONRedacted(t *testing.T) {
+	config.Providers = []ProviderInfo{
+		ProviderInfo{
+			Check: &Unhappy{},
+			Type:  "DBConn",
+		},
+	}
+	hz, err := New(config)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	req, err := http.NewRequest("GET", "/healthz", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	req = req.WithContext(WithRedaction(req.Context()))
+	req.Header.Set("Accept", HealthJSONMediaType)
+	w := httptest.NewRecorder()
+	hz.HandleHealthz(w, req)
+	resp := &HealthJSONResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+		t.Fatal(err.Error())
+	}
+	check := resp.Checks["DBConn:responseTime"]
+	if len(check) != 1 || check[0].Status != HealthFail || check[0].Output != "" || check[0].ComponentID != "" {
+		t.Fatalf("Expected a redacted failed check, got: %+v", check)
+	}
+}
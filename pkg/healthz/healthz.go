@@ -19,13 +19,17 @@ package healthz
 // add to your main TLS server.
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	stdLibLog "log"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
+	metrics "github.com/rcrowley/go-metrics"
 	"github.com/sirupsen/logrus"
 )
 
@@ -35,10 +39,29 @@ type HealthCheckable interface {
 	HealthZ() error
 }
 
+// DefaultTimeout bounds a provider check when neither its ProviderInfo nor
+// the Config set a timeout.
+const DefaultTimeout = 10 * time.Second
+
+// TimeoutTypeSuffix is appended to the Type of a provider whose check timed
+// out, so that timeouts can be told apart from check failures.
+const TimeoutTypeSuffix = "Timeout"
+
 type ProviderInfo struct {
-	Check       HealthCheckable
-	Description string
-	Type        string
+	// Check or CheckContext runs the health check. A Check implementing
+	// HealthCheckableContext is called with a context as well.
+	Check        HealthCheckable
+	CheckContext HealthCheckableContext
+	Description  string
+	Type         string
+	// Timeout bounds the check, defaults to Config.DefaultTimeout.
+	Timeout time.Duration
+	// Probes lists the Kubernetes probes the provider takes part in, on top
+	// of /healthz which runs every provider.
+	Probes Probe
+	// Criticality decides whether a failure fails the probes, defaults to
+	// Critical.
+	Criticality Criticality
 }
 
 type Error struct {
@@ -50,6 +73,9 @@ type Error struct {
 type HTTPResponse struct {
 	Errors   []Error
 	Hostname string
+	// CheckedAt is the time of the cached results, unset when the checks
+	// ran for the request.
+	CheckedAt *time.Time `json:",omitempty"`
 }
 
 type Config struct {
@@ -57,15 +83,42 @@ type Config struct {
 	BindAddr  string
 	Providers []ProviderInfo
 	Hostname  string
+	// DefaultTimeout bounds the checks of providers without a Timeout,
+	// defaults to DefaultTimeout.
+	DefaultTimeout time.Duration
+	// CheckInterval enables background checks run by RunChecks. The
+	// handlers then serve the cached results instead of running checks.
+	CheckInterval time.Duration
+	// HistorySize is the number of results kept per provider for
+	// `/healthz/history`, defaults to DefaultHistorySize.
+	HistorySize int
+	// Registry receives the check metrics, defaults to metrics.DefaultRegistry.
+	Registry metrics.Registry
+	// Version and ServiceID are reported in the health+json format.
+	Version   string
+	ServiceID string
 }
 
 type HealthChecker struct {
-	Providers []ProviderInfo
-	Server    *http.Server
-	Hostname  string
+	Providers      []ProviderInfo
+	Server         *http.Server
+	Hostname       string
+	DefaultTimeout time.Duration
+	CheckInterval  time.Duration
+	Version        string
+	ServiceID      string
+
+	cache   resultCache
+	history []*history
+	metrics []*providerMetrics
 }
 
 func New(config Config) (*HealthChecker, error) {
+	for _, p := range config.Providers {
+		if p.Check == nil && p.CheckContext == nil {
+			return nil, fmt.Errorf("healthz provider %q has neither Check nor CheckContext", p.Type)
+		}
+	}
 	// Hostname is sent in check results, so that we can tell which pod the health check is failing on.
 	if config.Hostname == "" {
 		var err error
@@ -77,13 +130,33 @@ func New(config Config) (*HealthChecker, error) {
 	}
 
 	w := log.Logger.Writer()
+	if config.DefaultTimeout <= 0 {
+		config.DefaultTimeout = DefaultTimeout
+	}
+	if config.HistorySize <= 0 {
+		config.HistorySize = DefaultHistorySize
+	}
 	h := &HealthChecker{
-		Providers: config.Providers,
-		Hostname:  config.Hostname,
+		Providers:      config.Providers,
+		Hostname:       config.Hostname,
+		DefaultTimeout: config.DefaultTimeout,
+		CheckInterval:  config.CheckInterval,
+		Version:        config.Version,
+		ServiceID:      config.ServiceID,
+	}
+	if config.Registry == nil {
+		config.Registry = metrics.DefaultRegistry
+	}
+	for _, provider := range config.Providers {
+		h.history = append(h.history, newHistory(config.HistorySize))
+		h.metrics = append(h.metrics, newProviderMetrics(provider, config.Registry))
 	}
 	mux := http.NewServeMux()
 	mux.Handle("/healthz", http.HandlerFunc(h.HandleHealthz))
+	mux.Handle("/healthz/history", http.HandlerFunc(h.HandleHistory))
 	mux.Handle("/liveness", http.HandlerFunc(h.HandleLiveness))
+	mux.Handle("/readyz", http.HandlerFunc(h.HandleReadiness))
+	mux.Handle("/startupz", http.HandlerFunc(h.HandleStartup))
 	h.Server = &http.Server{
 		Addr:           fmt.Sprintf("%s:%d", config.BindAddr, config.BindPort),
 		ReadTimeout:    time.Second * 45,
@@ -95,22 +168,15 @@ func New(config Config) (*HealthChecker, error) {
 	return h, nil
 }
 
-// HandleHealthz is the http handler for `/healthz`
+// HandleHealthz is the http handler for `/healthz`. Clients accepting
+// HealthJSONMediaType get the health+json format, others the legacy
+// HTTPResponse.
 func (h *HealthChecker) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	results, checkedAt := h.results(w, r, 0)
 	resp := &HTTPResponse{
-		Hostname: h.Hostname,
-	}
-
-	// Check all our health providers
-	for _, provider := range h.Providers {
-		err := provider.Check.HealthZ()
-		if err != nil {
-			resp.Errors = append(resp.Errors, Error{
-				Type:        provider.Type,
-				ErrMsg:      err.Error(),
-				Description: provider.Description,
-			})
-		}
+		Hostname:  h.Hostname,
+		Errors:    failures(results),
+		CheckedAt: cachedAt(checkedAt),
 	}
 	if len(resp.Errors) > 0 {
 		for _, e := range resp.Errors {
@@ -123,6 +189,14 @@ func (h *HealthChecker) HandleHealthz(w http.ResponseWriter, r *http.Request) {
 	} else {
 		log.Debug("All checks passed")
 	}
+	if acceptsHealthJSON(r) {
+		h.writeHealthJSON(w, results, redacted(r.Context()))
+		return
+	}
+	if redacted(r.Context()) {
+		resp.Hostname = ""
+		redactErrors(resp.Errors)
+	}
 	enc := json.NewEncoder(w)
 	w.Header().Set("Content-Type", "application/json")
 
@@ -137,12 +211,93 @@ func (h *HealthChecker) HandleHealthz(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// HandleLiveness is the http handler for `/liveness`
-func (h *HealthChecker) HandleLiveness(w http.ResponseWriter, r *http.Request) {
-	// log.Debug("Liveness check: OK")
-	_, err := w.Write([]byte("OK"))
-	if err != nil {
-		log.Errorln(err)
+// checkResult is the outcome of a provider check, Err is nil on success.
+type checkResult struct {
+	Provider ProviderInfo
+	Err      *Error
+	Time     time.Time
+	Duration time.Duration
+}
+
+// runChecks runs the providers taking part in probe concurrently, or all of
+// them if probe is 0, and returns their results in provider order.
+func (h *HealthChecker) runChecks(ctx context.Context, probe Probe) []checkResult {
+	var indexes []int
+	for i, provider := range h.Providers {
+		if probe == 0 || provider.Probes&probe != 0 {
+			indexes = append(indexes, i)
+		}
+	}
+	results := make([]checkResult, len(indexes))
+	var wg sync.WaitGroup
+	for n, i := range indexes {
+		wg.Add(1)
+		go func(n, i int) {
+			defer wg.Done()
+			provider := h.Providers[i]
+			start := time.Now()
+			results[n] = checkResult{
+				Provider: provider,
+				Err:      h.check(ctx, provider),
+				Time:     start,
+				Duration: time.Since(start),
+			}
+			h.history[i].add(results[n])
+			h.metrics[i].record(results[n])
+		}(n, i)
+	}
+	wg.Wait()
+	return results
+}
+
+// failures returns the errors of the failed results.
+func failures(results []checkResult) []Error {
+	var errs []Error
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, *r.Err)
+		}
+	}
+	return errs
+}
+
+// check runs a single provider with a context bounded by its timeout. A
+// check that ignores the context is abandoned once the context is done.
+func (h *HealthChecker) check(ctx context.Context, provider ProviderInfo) *Error {
+	timeout := provider.Timeout
+	if timeout <= 0 {
+		timeout = h.DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Buffered, so that a check finishing after the context does not block.
+	result := make(chan error, 1)
+	go func() {
+		result <- provider.contextChecker().HealthZContext(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == context.DeadlineExceeded:
+		return &Error{
+			Type:        provider.Type + TimeoutTypeSuffix,
+			ErrMsg:      fmt.Sprintf("check timed out after %s", timeout),
+			Description: provider.Description,
+		}
+	default:
+		return &Error{
+			Type:        provider.Type,
+			ErrMsg:      err.Error(),
+			Description: provider.Description,
+		}
 	}
 }
 
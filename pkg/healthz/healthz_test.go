@@ -1,9 +1,11 @@
 package healthz
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -125,6 +127,106 @@ func TestMultipleOneUnhappy(t *testing.T) {
 	}
 }
 
+func TestTimeout(t *testing.T) {
+	hang := make(chan struct{})
+	defer close(hang)
+	config.Providers = []ProviderInfo{
+		ProviderInfo{
+			Check:       &Hanging{release: hang},
+			Type:        "DBConn",
+			Description: "Ensure the database connection is up",
+			Timeout:     50 * time.Millisecond,
+		},
+		ProviderInfo{
+			Check:       &Unhappy{},
+			Type:        "Foo",
+			Description: "Ensure we can reach Foo",
+		},
+	}
+	hz, err := New(config)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	req, err := http.NewRequest("GET", "/healthz", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	w := httptest.NewRecorder()
+	start := time.Now()
+	hz.Server.Handler.ServeHTTP(w, req)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatal("Expected the hanging check to be abandoned after its timeout, took:", elapsed)
+	}
+	if w.Code != 200 {
+		t.Fatal("Expected 200 OK, got:", w.Code)
+	}
+	if w.Body.String() != `{"Errors":[{"Type":"DBConnTimeout","ErrMsg":"check timed out after 50ms","Description":"Ensure the database connection is up"},{"Type":"Foo","ErrMsg":"failed","Description":"Ensure we can reach Foo"}],"Hostname":"tester"}`+"\n" {
+		t.Fatal("Unexpected JSON body, got:", w.Body.String())
+	}
+}
+
+func TestContextCheckCancelled(t *testing.T) {
+	check := &ContextAware{cancelled: make(chan struct{}), started: make(chan struct{})}
+	config.Providers = []ProviderInfo{
+		ProviderInfo{
+			CheckContext: check,
+			Type:         "DBConn",
+			Description:  "Ensure the database connection is up",
+			Timeout:      time.Minute,
+		},
+	}
+	hz, err := New(config)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequest("GET", "/healthz", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	req = req.WithContext(ctx)
+	// The client goes away while the check is running.
+	go func() {
+		<-check.started
+		cancel()
+	}()
+	w := httptest.NewRecorder()
+	hz.Server.Handler.ServeHTTP(w, req)
+
+	select {
+	case <-check.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the check context to be cancelled with the request")
+	}
+	if w.Body.String() != `{"Errors":[{"Type":"DBConn","ErrMsg":"context canceled","Description":"Ensure the database connection is up"}],"Hostname":"tester"}`+"\n" {
+		t.Fatal("Unexpected JSON body, got:", w.Body.String())
+	}
+}
+
+func TestContextCheckTimeout(t *testing.T) {
+	config.Providers = []ProviderInfo{
+		ProviderInfo{
+			CheckContext: &ContextAware{cancelled: make(chan struct{}), started: make(chan struct{})},
+			Type:         "DBConn",
+			Description:  "Ensure the database connection is up",
+			Timeout:      50 * time.Millisecond,
+		},
+	}
+	hz, err := New(config)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	req, err := http.NewRequest("GET", "/healthz", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	w := httptest.NewRecorder()
+	hz.Server.Handler.ServeHTTP(w, req)
+	if w.Body.String() != `{"Errors":[{"Type":"DBConnTimeout","ErrMsg":"check timed out after 50ms","Description":"Ensure the database connection is up"}],"Hostname":"tester"}`+"\n" {
+		t.Fatal("Unexpected JSON body, got:", w.Body.String())
+	}
+}
+
 type Happy struct{}
 
 func (hz *Happy) HealthZ() error {
@@ -136,3 +238,25 @@ type Unhappy struct{}
 func (hz *Unhappy) HealthZ() error {
 	return errors.New("failed")
 }
+
+type Hanging struct {
+	release chan struct{}
+}
+
+func (hz *Hanging) HealthZ() error {
+	<-hz.release
+	return nil
+}
+
+// ContextAware blocks until its context is cancelled.
+type ContextAware struct {
+	started   chan struct{}
+	cancelled chan struct{}
+}
+
+func (hz *ContextAware) HealthZContext(ctx context.Context) error {
+	close(hz.started)
+	<-ctx.Done()
+	close(hz.cancelled)
+	return ctx.Err()
+}
@@ -0,0 +1,41 @@
+package healthz
+
+import (
+	"regexp"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// metricNameUnsafe matches the characters not allowed in a dotted metric
+// path segment.
+var metricNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// providerMetrics holds the metrics published for a provider under
+// `healthz.<type>.`:
+//   - status: 1 if the last check passed, 0 otherwise.
+//   - latency: timer of the check durations.
+//   - failures: counter of the failed checks, timeouts included.
+type providerMetrics struct {
+	status   metrics.Gauge
+	latency  metrics.Timer
+	failures metrics.Counter
+}
+
+func newProviderMetrics(provider ProviderInfo, registry metrics.Registry) *providerMetrics {
+	prefix := "healthz." + metricNameUnsafe.ReplaceAllString(provider.Type, "_") + "."
+	return &providerMetrics{
+		status:   metrics.GetOrRegisterGauge(prefix+"status", registry),
+		latency:  metrics.GetOrRegisterTimer(prefix+"latency", registry),
+		failures: metrics.GetOrRegisterCounter(prefix+"failures", registry),
+	}
+}
+
+func (m *providerMetrics) record(result checkResult) {
+	m.latency.Update(result.Duration)
+	if result.Err != nil {
+		m.status.Update(0)
+		m.failures.Inc(1)
+		return
+	}
+	m.status.Update(1)
+}
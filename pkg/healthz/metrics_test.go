@@ -0,0 +1,42 @@
+package healthz
+
+import (
+	"testing"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	cfg := config
+	cfg.Registry = registry
+	cfg.Providers = []ProviderInfo{
+		ProviderInfo{
+			Check: &Unhappy{},
+			Type:  "DB Conn",
+		},
+		ProviderInfo{
+			Check: &Happy{},
+			Type:  "Foo",
+		},
+	}
+	hz, err := New(cfg)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	probeRequest(t, hz, "/healthz")
+	probeRequest(t, hz, "/healthz")
+
+	if n := registry.Get("healthz.DB_Conn.failures").(metrics.Counter).Count(); n != 2 {
+		t.Fatal("Expected 2 failures, got:", n)
+	}
+	if v := registry.Get("healthz.DB_Conn.status").(metrics.Gauge).Value(); v != 0 {
+		t.Fatal("Expected failed status 0, got:", v)
+	}
+	if v := registry.Get("healthz.Foo.status").(metrics.Gauge).Value(); v != 1 {
+		t.Fatal("Expected passed status 1, got:", v)
+	}
+	if n := registry.Get("healthz.Foo.latency").(metrics.Timer).Count(); n != 2 {
+		t.Fatal("Expected 2 latency samples, got:", n)
+	}
+}
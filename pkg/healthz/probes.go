@@ -0,0 +1,126 @@
+package healthz
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Probe is a set of Kubernetes probes a provider takes part in.
+type Probe int
+
+// There is no liveness probe: `/liveness` runs no check, so a failing
+// dependency never gets the pod restarted.
+const (
+	// Readiness probes are served at `/readyz`.
+	Readiness Probe = 1 << iota
+	// Startup probes are served at `/startupz`.
+	Startup
+)
+
+func (p Probe) String() string {
+	switch p {
+	case Readiness:
+		return "readiness"
+	case Startup:
+		return "startup"
+	}
+	return "unknown"
+}
+
+// Criticality decides whether a failing provider fails the probes it takes
+// part in.
+type Criticality int
+
+const (
+	// Critical failures fail the probe with `503 Service Unavailable`.
+	Critical Criticality = iota
+	// Warning failures are reported in the probe body only.
+	Warning
+)
+
+// Probe statuses reported in ProbeResponse.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// ProbeResponse is the body of the Kubernetes probe endpoints.
+type ProbeResponse struct {
+	Status   string
+	Errors   []Error
+	Warnings []Error
+	Hostname string
+	// CheckedAt is the time of the cached results, unset when the checks
+	// ran for the request.
+	CheckedAt *time.Time `json:",omitempty"`
+}
+
+// HandleLiveness is the http handler for `/liveness`. It always answers "OK"
+// as long as the process serves requests.
+func (h *HealthChecker) HandleLiveness(w http.ResponseWriter, r *http.Request) {
+	_, err := w.Write([]byte("OK"))
+	if err != nil {
+		log.Errorln(err)
+	}
+}
+
+// HandleReadiness is the http handler for `/readyz`.
+func (h *HealthChecker) HandleReadiness(w http.ResponseWriter, r *http.Request) {
+	writeProbeResponse(w, h.probe(w, r, Readiness))
+}
+
+// HandleStartup is the http handler for `/startupz`.
+func (h *HealthChecker) HandleStartup(w http.ResponseWriter, r *http.Request) {
+	writeProbeResponse(w, h.probe(w, r, Startup))
+}
+
+// probe returns the results of the providers taking part in probe.
+func (h *HealthChecker) probe(w http.ResponseWriter, r *http.Request, probe Probe) *ProbeResponse {
+	results, checkedAt := h.results(w, r, probe)
+	resp := &ProbeResponse{
+		Status:    StatusOK,
+		Hostname:  h.Hostname,
+		CheckedAt: cachedAt(checkedAt),
+	}
+	for _, result := range results {
+		if result.Err == nil {
+			continue
+		}
+		log := log.WithFields(logrus.Fields{
+			"error":       result.Err.ErrMsg,
+			"healthzDesc": result.Err.Description,
+			"healthzType": result.Err.Type,
+			"probe":       probe.String(),
+		})
+		if result.Provider.Criticality == Warning {
+			resp.Warnings = append(resp.Warnings, *result.Err)
+			log.Warn("Check failed")
+			continue
+		}
+		resp.Status = StatusFail
+		resp.Errors = append(resp.Errors, *result.Err)
+		log.Error("Check failed")
+	}
+	if redacted(r.Context()) {
+		resp.Hostname = ""
+		redactErrors(resp.Errors)
+		redactErrors(resp.Warnings)
+	}
+	return resp
+}
+
+func writeProbeResponse(w http.ResponseWriter, resp *ProbeResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status == StatusOK {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	err := json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		log.Error(err)
+	}
+}
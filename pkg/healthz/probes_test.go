@@ -0,0 +1,76 @@
+package healthz
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func probeRequest(t *testing.T, hz *HealthChecker, path string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	w := httptest.NewRecorder()
+	hz.Server.Handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestProbes(t *testing.T) {
+	config.Providers = []ProviderInfo{
+		ProviderInfo{
+			Check:       &Unhappy{},
+			Type:        "DBConn",
+			Description: "Ensure the database connection is up",
+			Probes:      Readiness,
+		},
+		ProviderInfo{
+			Check:       &Unhappy{},
+			Type:        "CertExpiry",
+			Description: "Ensure the certificate is not about to expire",
+			Probes:      Readiness | Startup,
+			Criticality: Warning,
+		},
+		ProviderInfo{
+			Check:       &Happy{},
+			Type:        "App",
+			Description: "Check app health",
+			Probes:      Readiness | Startup,
+		},
+	}
+	hz, err := New(config)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	w := probeRequest(t, hz, "/readyz")
+	if w.Code != 503 {
+		t.Fatal("Expected 503 Service Unavailable, got:", w.Code)
+	}
+	if w.Body.String() != `{"Status":"fail","Errors":[{"Type":"DBConn","ErrMsg":"failed","Description":"Ensure the database connection is up"}],"Warnings":[{"Type":"CertExpiry","ErrMsg":"failed","Description":"Ensure the certificate is not about to expire"}],"Hostname":"tester"}`+"\n" {
+		t.Fatal("Unexpected JSON body, got:", w.Body.String())
+	}
+
+	w = probeRequest(t, hz, "/startupz")
+	if w.Code != 200 {
+		t.Fatal("Expected 200 OK, got:", w.Code)
+	}
+	if w.Body.String() != `{"Status":"ok","Errors":null,"Warnings":[{"Type":"CertExpiry","ErrMsg":"failed","Description":"Ensure the certificate is not about to expire"}],"Hostname":"tester"}`+"\n" {
+		t.Fatal("Unexpected JSON body, got:", w.Body.String())
+	}
+
+	// Liveness runs no check: a failing critical provider keeps it OK.
+	w = probeRequest(t, hz, "/liveness")
+	if w.Code != 200 || w.Body.String() != "OK" {
+		t.Fatal("Expected 200 OK, got:", w.Code, w.Body.String())
+	}
+
+	// The /healthz contract is unchanged: every provider, always 200.
+	w = probeRequest(t, hz, "/healthz")
+	if w.Code != 200 {
+		t.Fatal("Expected 200 OK, got:", w.Code)
+	}
+	if w.Body.String() != `{"Errors":[{"Type":"DBConn","ErrMsg":"failed","Description":"Ensure the database connection is up"},{"Type":"CertExpiry","ErrMsg":"failed","Description":"Ensure the certificate is not about to expire"}],"Hostname":"tester"}`+"\n" {
+		t.Fatal("Unexpected JSON body, got:", w.Body.String())
+	}
+}
@@ -0,0 +1,24 @@
+package healthz
+
+import "context"
+
+type redactKey struct{}
+
+// WithRedaction returns a copy of ctx that makes the handlers leave out the
+// error messages, descriptions and hostname from their response, for
+// requests from clients that should only see which checks fail.
+func WithRedaction(ctx context.Context) context.Context {
+	return context.WithValue(ctx, redactKey{}, true)
+}
+
+func redacted(ctx context.Context) bool {
+	redact, _ := ctx.Value(redactKey{}).(bool)
+	return redact
+}
+
+// redactErrors strips the details from errs in place, keeping their Type.
+func redactErrors(errs []Error) {
+	for i := range errs {
+		errs[i] = Error{Type: errs[i].Type}
+	}
+}
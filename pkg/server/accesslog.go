@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the ID of a request, it is propagated from the
+// client if valid and returned in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// Request context keys of the request ID and the request-scoped logger.
+const (
+	requestIDKey = contextKey("request-id")
+	loggerKey    = contextKey("logger")
+)
+
+// attrRequestID is the span attribute of the request ID.
+const attrRequestID = attribute.Key("http.request_id")
+
+// validRequestID matches the client request IDs propagated as is, others are
+// replaced so that they cannot be used to forge log lines.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// NewRequestID returns a random 128-bit request ID.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// The crypto/rand reader does not fail on supported platforms.
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// RequestIDFromContext returns the request ID set by AccessLogHandler, empty
+// if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// LoggerFromContext returns the request-scoped logger set by
+// AccessLogHandler, or the server logger outside of a request.
+func LoggerFromContext(ctx context.Context) *logrus.Entry {
+	if l, ok := ctx.Value(loggerKey).(*logrus.Entry); ok && l != nil {
+		return l
+	}
+	return log.WithContext(ctx)
+}
+
+// AccessLogHandler assigns each request of the route registered with method
+// and path an ID, taken from the X-Request-ID header if valid, and stores it
+// on the request context along with a logger carrying the request fields.
+// One access log line is written when the request completes.
+func AccessLogHandler(method, path string, h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		start := time.Now()
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		ctx := r.Context()
+		trace.SpanFromContext(ctx).SetAttributes(attrRequestID.String(requestID))
+		fields := logrus.Fields{
+			"requestID":  requestID,
+			"method":     method,
+			"route":      path,
+			"remoteAddr": r.RemoteAddr,
+		}
+		if id, err := IdentityFromRequest(r); err == nil {
+			fields["clientCN"] = id.CommonName
+			fields["clientOU"] = id.OrganizationalUnits
+			fields["clientSPIFFEID"] = id.SPIFFEID
+		}
+		// WithContext lets the tracing hook add the IDs of the request span.
+		reqLog := log.WithContext(ctx).WithFields(fields)
+		ctx = context.WithValue(ctx, requestIDKey, requestID)
+		ctx = context.WithValue(ctx, loggerKey, reqLog)
+
+		sw := &statusWriter{ResponseWriter: w}
+		h(sw, r.WithContext(ctx), ps)
+
+		reqLog.WithFields(logrus.Fields{
+			"path":       r.URL.Path,
+			"status":     sw.status(),
+			"bytes":      sw.n,
+			"durationMs": float64(time.Since(start)) / float64(time.Millisecond),
+		}).Info("access")
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// captureLog sends the server log lines to a buffer, in JSON, until the
+// returned func is called.
+func captureLog() (*bytes.Buffer, func()) {
+	buf := &bytes.Buffer{}
+	logger := log.Logger
+	out, formatter := logger.Out, logger.Formatter
+	logger.SetOutput(buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	return buf, func() {
+		logger.SetOutput(out)
+		logger.SetFormatter(formatter)
+	}
+}
+
+func TestAccessLogHandler(t *testing.T) {
+	buf, restore := captureLog()
+	defer restore()
+
+	var requestID string
+	h := AccessLogHandler("GET", "/v1/demo/:id", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		requestID = RequestIDFromContext(r.Context())
+		LoggerFromContext(r.Context()).Info("handled")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})
+
+	r := httptest.NewRequest("GET", "/v1/demo/1", nil)
+	r.Header.Set(RequestIDHeader, "req-1234")
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "client", OrganizationalUnit: []string{"site"}}}
+	r.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	w := httptest.NewRecorder()
+	h(w, r, nil)
+
+	if requestID != "req-1234" {
+		t.Errorf("expected the client request ID in the context, got %q", requestID)
+	}
+	if got := w.Header().Get(RequestIDHeader); got != "req-1234" {
+		t.Errorf("expected the request ID in the response, got %q", got)
+	}
+
+	dec := json.NewDecoder(buf)
+	var handled, access map[string]interface{}
+	if err := dec.Decode(&handled); err != nil {
+		t.Fatalf("expected the handler log line: %s", err)
+	}
+	if err := dec.Decode(&access); err != nil {
+		t.Fatalf("expected the access log line: %s", err)
+	}
+	for _, line := range []map[string]interface{}{handled, access} {
+		if line["requestID"] != "req-1234" || line["route"] != "/v1/demo/:id" || line["clientCN"] != "client" {
+			t.Errorf("expected the request fields, got %v", line)
+		}
+	}
+	if access["msg"] != "access" || access["status"] != float64(http.StatusTeapot) || access["bytes"] != float64(15) {
+		t.Errorf("expected the response status and size in the access log, got %v", access)
+	}
+	if _, ok := access["durationMs"]; !ok {
+		t.Errorf("expected the request duration in the access log, got %v", access)
+	}
+}
+
+func TestAccessLogHandlerRequestID(t *testing.T) {
+	_, restore := captureLog()
+	defer restore()
+
+	var requestID string
+	h := AccessLogHandler("GET", "/", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		requestID = RequestIDFromContext(r.Context())
+	})
+	for _, header := range []string{"", "bad\nid", string(make([]byte, 200))} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(RequestIDHeader, header)
+		w := httptest.NewRecorder()
+		h(w, r, nil)
+		if requestID == header || len(requestID) != 32 {
+			t.Errorf("expected a new request ID replacing %q, got %q", header, requestID)
+		}
+		if got := w.Header().Get(RequestIDHeader); got != requestID {
+			t.Errorf("expected the response request ID %q, got %q", requestID, got)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Codes of the error responses written by the server itself.
+const (
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeAuthFailed       = "authentication_failed"
+	CodeInternal         = "internal_error"
+)
+
+// Error is an error a handler returns to be written as the response. Its
+// Message is shown to the client, the wrapped Err only in the debug trace.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Err     error
+}
+
+// NewError returns an error responding with status. The code defaults to the
+// snake cased status text, e.g. `bad_request`, and the message to the status
+// text.
+func NewError(status int, message string, err error) *Error {
+	return &Error{Status: status, Message: message, Err: err}
+}
+
+// Errorf returns an error responding with status and the formatted message.
+func Errorf(status int, format string, args ...interface{}) *Error {
+	return NewError(status, fmt.Sprintf(format, args...), nil)
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// response returns the body of the error response.
+func (e *Error) response() ResponseBody {
+	body := ResponseBody{Code: e.Code, Message: e.Message}
+	if body.Code == "" {
+		body.Code = strings.ToLower(strings.Replace(http.StatusText(e.Status), " ", "_", -1))
+	}
+	if body.Message == "" {
+		body.Message = http.StatusText(e.Status)
+	}
+	return body
+}
+
+// ErrorHandle is a route handler returning an error instead of writing it.
+type ErrorHandle func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) error
+
+// HandleErrors adapts h to a route handler writing its errors with
+// WriteError.
+func (s *Server) HandleErrors(h ErrorHandle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if err := h(w, r, ps); err != nil {
+			s.WriteError(w, r, err)
+		}
+	}
+}
+
+// WriteError writes err as a JSON error response. An *Error in the chain of
+// err sets the status, code and message, any other error responds with a
+// 500. The full error is only returned in debug mode.
+func (s *Server) WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, err, s.Debug)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error, debug bool) {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = &Error{Status: http.StatusInternalServerError, Code: CodeInternal}
+	}
+	if e.Status >= http.StatusInternalServerError {
+		LoggerFromContext(r.Context()).WithError(err).Error("request failed")
+	}
+	var debugTrace string
+	if debug {
+		debugTrace = fmt.Sprintf("%+v", err)
+	}
+	writeErrorResponse(w, r, e, debugTrace)
+}
+
+// writeErrorResponse writes the JSON response of e.
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, e *Error, debugTrace string) {
+	body := e.response()
+	body.RequestID = requestID(w, r)
+	body.DebugTrace = debugTrace
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		LoggerFromContext(r.Context()).WithError(err).Error("unable to write the error response")
+	}
+}
+
+// requestID returns the ID of r. Requests not served by AccessLogHandler,
+// e.g. unmatched routes, are given one in the response.
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		return id
+	}
+	id := r.Header.Get(RequestIDHeader)
+	if !validRequestID.MatchString(id) {
+		id = NewRequestID()
+	}
+	w.Header().Set(RequestIDHeader, id)
+	return id
+}
+
+// NotFound returns the default response for when routes are not found.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, &Error{
+		Status:  http.StatusNotFound,
+		Code:    CodeNotFound,
+		Message: "The requested route does not exist.",
+	}, false)
+}
+
+// MethodNotAllowed is the response for routes not registered for the method
+// of the request.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, &Error{
+		Status:  http.StatusMethodNotAllowed,
+		Code:    CodeMethodNotAllowed,
+		Message: "The requested method is not allowed on this route.",
+	}, false)
+}
+
+// AuthFailed is the response for clients the auth policy denies.
+func AuthFailed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, &Error{
+		Status:  http.StatusForbidden,
+		Code:    CodeAuthFailed,
+		Message: "Authentication Failed",
+	}, false)
+}
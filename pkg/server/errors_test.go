@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) ResponseBody {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("expected a JSON error response, got %q: %s", ct, w.Body)
+	}
+	var body ResponseBody
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.RequestID == "" || body.RequestID != w.Header().Get(RequestIDHeader) {
+		t.Errorf("expected the request ID %q in the body, got %q", w.Header().Get(RequestIDHeader), body.RequestID)
+	}
+	return body
+}
+
+func TestRouterErrors(t *testing.T) {
+	s := &Server{}
+	policy, err := NewAuthPolicy([]PolicyRule{
+		{Path: "/v1/*", AllowedOUs: []string{"admin"}},
+		{Path: "/v1/*/*", AllowedOUs: []string{"admin"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, err := s.GetRouter(policy.Resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{"GET", "/v1/missing", http.StatusNotFound, CodeNotFound},
+		{"DELETE", "/v1/demo-get", http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+		// No client certificate.
+		{"GET", "/v1/demo-get", http.StatusForbidden, CodeAuthFailed},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, tt.status, w.Code)
+			continue
+		}
+		body := decodeError(t, w)
+		if body.Code != tt.code || body.Message == "" {
+			t.Errorf("%s %s: expected code %s with a message, got %+v", tt.method, tt.path, tt.code, body)
+		}
+	}
+}
+
+func TestHandleErrors(t *testing.T) {
+	tests := []struct {
+		err        error
+		debug      bool
+		status     int
+		code       string
+		message    string
+		debugTrace string
+	}{
+		{Errorf(http.StatusBadRequest, "invalid site %q", "x"), false, http.StatusBadRequest, "bad_request", `invalid site "x"`, ""},
+		{&Error{Status: http.StatusConflict, Code: "site_locked"}, false, http.StatusConflict, "site_locked", "Conflict", ""},
+		{NewError(http.StatusBadGateway, "", errors.New("upstream down")), true, http.StatusBadGateway, "bad_gateway", "Bad Gateway", "Bad Gateway: upstream down"},
+		{errors.New("secret detail"), false, http.StatusInternalServerError, CodeInternal, "Internal Server Error", ""},
+		{errors.New("secret detail"), true, http.StatusInternalServerError, CodeInternal, "Internal Server Error", "secret detail"},
+	}
+	for _, tt := range tests {
+		s := &Server{Debug: tt.debug}
+		h := s.HandleErrors(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) error {
+			return tt.err
+		})
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest("GET", "/", nil), nil)
+		if w.Code != tt.status {
+			t.Errorf("%v: expected %d, got %d", tt.err, tt.status, w.Code)
+			continue
+		}
+		body := decodeError(t, w)
+		if body.Code != tt.code || body.Message != tt.message || body.DebugTrace != tt.debugTrace {
+			t.Errorf("%v: expected %s %q %q, got %+v", tt.err, tt.code, tt.message, tt.debugTrace, body)
+		}
+	}
+}
+
+func TestPanicHandler(t *testing.T) {
+	s := &Server{Debug: true}
+	router, err := s.GetRouter(mockAuthResolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router.(*httprouter.Router).GET("/v1/panic", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+	body := decodeError(t, w)
+	if body.Code != CodeInternal || !strings.Contains(body.DebugTrace, "boom") {
+		t.Errorf("expected an internal error with the panic in the debug trace, got %+v", body)
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pantheon-systems/go-demo-service/pkg/healthz"
+)
+
+type failingCheck struct{}
+
+func (failingCheck) HealthZ() error {
+	return errors.New("connection refused")
+}
+
+func TestHealthzRoutes(t *testing.T) {
+	policy, err := NewAuthPolicy([]PolicyRule{
+		{Name: "demo", Path: "/v1/demo-*", AllowedOUs: []string{"admin"}},
+		{Name: "healthz-verbose", Path: "/v1/*/verbose", AllowedOUs: []string{"admin"}},
+		{Name: "healthz", Path: "/v1/healthz", AllowedOUs: []string{"admin", "monitoring"}},
+		{Name: "readyz", Path: "/v1/readyz", AllowedOUs: []string{"admin", "monitoring"}},
+		{Name: "liveness", Path: "/v1/liveness", AllowedOUs: []string{"admin", "monitoring"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hz, err := healthz.New(healthz.Config{
+		Hostname: "tester",
+		Providers: []healthz.ProviderInfo{
+			{
+				Check:       failingCheck{},
+				Type:        "DBConn",
+				Description: "Ensure the database connection is up",
+				Probes:      healthz.Readiness,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := New(Config{AuthResolver: policy.Resolve})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.HealthzHandler = hz.HandleHealthz
+	server.ReadinessHandler = hz.HandleReadiness
+	server.LivenessHandler = hz.HandleLiveness
+	router, err := server.GetRouter(policy.Resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ou   string
+		path string
+		code int
+		body string
+	}{
+		{"monitoring", "/v1/healthz", http.StatusOK, `{"Errors":[{"Type":"DBConn","ErrMsg":"","Description":""}],"Hostname":""}` + "\n"},
+		{"monitoring", "/v1/readyz", http.StatusServiceUnavailable, `{"Status":"fail","Errors":[{"Type":"DBConn","ErrMsg":"","Description":""}],"Warnings":null,"Hostname":""}` + "\n"},
+		{"monitoring", "/v1/liveness", http.StatusOK, "OK"},
+		{"monitoring", "/v1/healthz/verbose", http.StatusForbidden, ""},
+		{"monitoring", "/v1/readyz/verbose", http.StatusForbidden, ""},
+		{"site", "/v1/healthz", http.StatusForbidden, ""},
+		{"admin", "/v1/healthz/verbose", http.StatusOK, `{"Errors":[{"Type":"DBConn","ErrMsg":"connection refused","Description":"Ensure the database connection is up"}],"Hostname":"tester"}` + "\n"},
+		{"admin", "/v1/readyz/verbose", http.StatusServiceUnavailable, `{"Status":"fail","Errors":[{"Type":"DBConn","ErrMsg":"connection refused","Description":"Ensure the database connection is up"}],"Warnings":null,"Hostname":"tester"}` + "\n"},
+		{"admin", "/v1/liveness/verbose", http.StatusOK, "OK"},
+	}
+	for _, test := range tests {
+		cert := &x509.Certificate{Subject: pkix.Name{OrganizationalUnit: []string{test.ou}}}
+		r, _ := http.NewRequest("GET", test.path, nil)
+		r.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s %s: want %d response code, got: %d", test.ou, test.path, test.code, w.Code)
+			continue
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s %s: unexpected body, got: %s", test.ou, test.path, w.Body.String())
+		}
+	}
+}
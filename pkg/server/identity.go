@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type contextKey string
+
+func (c contextKey) String() string {
+	return "server context " + string(c)
+}
+
+// identityKey is the request context key holding the caller *Identity.
+const identityKey = contextKey("identity")
+
+// spiffeScheme is the URI scheme of SPIFFE IDs, e.g.
+// spiffe://trust-domain/ns/x/sa/y.
+const spiffeScheme = "spiffe"
+
+// Identity describes the client of a request as presented by its verified
+// certificate.
+type Identity struct {
+	CommonName          string
+	OrganizationalUnits []string
+	DNSNames            []string
+	URIs                []string
+	// SPIFFEID is the first valid spiffe:// URI SAN, empty if there is none.
+	SPIFFEID string
+}
+
+// NewIdentity extracts the identity from a verified peer certificate.
+func NewIdentity(cert *x509.Certificate) *Identity {
+	id := &Identity{
+		CommonName:          cert.Subject.CommonName,
+		OrganizationalUnits: cert.Subject.OrganizationalUnit,
+		DNSNames:            cert.DNSNames,
+	}
+	for _, u := range cert.URIs {
+		id.URIs = append(id.URIs, u.String())
+		if id.SPIFFEID == "" && validSPIFFEID(u) == nil {
+			id.SPIFFEID = u.String()
+		}
+	}
+	return id
+}
+
+// IdentityFromRequest returns the identity of the verified client certificate
+// of r.
+func IdentityFromRequest(r *http.Request) (*Identity, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, fmt.Errorf("no verified client certificate")
+	}
+	return NewIdentity(r.TLS.VerifiedChains[0][0]), nil
+}
+
+// WithIdentity returns a copy of ctx carrying id.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey, id)
+}
+
+// IdentityFromContext returns the caller identity stored by IdentityHandler.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey).(*Identity)
+	return id, ok && id != nil
+}
+
+// IdentityHandler stores the caller identity on the request context. Requests
+// without a verified certificate are passed through untouched and left to the
+// auth wrappers to reject.
+func IdentityHandler(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		id, err := IdentityFromRequest(r)
+		if err == nil {
+			r = r.WithContext(WithIdentity(r.Context(), id))
+		}
+		h(w, r, ps)
+	}
+}
+
+// SPIFFEAuthHandler allows clients whose SPIFFE ID matches one of the
+// path.Match patterns, e.g. "spiffe://cluster.local/ns/*/sa/titan".
+func SPIFFEAuthHandler(patterns []string) HandlerWrapper {
+	return func(h httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			id, ok := IdentityFromContext(r.Context())
+			if !ok {
+				var err error
+				id, err = IdentityFromRequest(r)
+				if err != nil {
+					AuthFailed(w, r)
+					return
+				}
+			}
+			if !matchSPIFFEID(id.SPIFFEID, patterns) {
+				log.Debugf("cert failed SPIFFE ID validation for %q, allowed: %v", id.SPIFFEID, patterns)
+				AuthFailed(w, r)
+				return
+			}
+			h(w, r, ps)
+		}
+	}
+}
+
+func matchSPIFFEID(spiffeID string, patterns []string) bool {
+	if spiffeID == "" {
+		return false
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, spiffeID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validSPIFFEPattern checks that p is a well-formed SPIFFE ID pattern.
+func validSPIFFEPattern(p string) error {
+	if !strings.HasPrefix(p, spiffeScheme+"://") {
+		return fmt.Errorf("SPIFFE ID pattern %q must start with %s://", p, spiffeScheme)
+	}
+	_, err := path.Match(p, "")
+	return err
+}
+
+// validSPIFFEID checks u against the SPIFFE ID format: a spiffe scheme, a
+// trust domain and no user info, port, query or fragment.
+func validSPIFFEID(u *url.URL) error {
+	switch {
+	case u.Scheme != spiffeScheme:
+		return fmt.Errorf("scheme is not %s", spiffeScheme)
+	case u.Host == "":
+		return fmt.Errorf("trust domain is empty")
+	case u.User != nil || u.Port() != "":
+		return fmt.Errorf("user info and port are not allowed")
+	case u.RawQuery != "" || u.Fragment != "":
+		return fmt.Errorf("query and fragment are not allowed")
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestIdentityHandler(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject: pkix.Name{CommonName: "client1", OrganizationalUnit: []string{"titan"}},
+		URIs: []*url.URL{
+			mustParseURL(t, "https://example.com/not-spiffe"),
+			mustParseURL(t, "spiffe://cluster.local/ns/shared/sa/titan"),
+		},
+	}
+	var got *Identity
+	h := IdentityHandler(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		got, _ = IdentityFromContext(r.Context())
+	})
+	serveWithCert(h, cert)
+
+	if got == nil {
+		t.Fatal("expected an identity on the request context")
+	}
+	if got.CommonName != "client1" || len(got.OrganizationalUnits) != 1 || got.OrganizationalUnits[0] != "titan" {
+		t.Fatalf("unexpected subject in identity: %+v", got)
+	}
+	if len(got.URIs) != 2 {
+		t.Fatalf("expected 2 URI SANs, got: %v", got.URIs)
+	}
+	if got.SPIFFEID != "spiffe://cluster.local/ns/shared/sa/titan" {
+		t.Fatalf("unexpected SPIFFE ID: %q", got.SPIFFEID)
+	}
+}
+
+func TestSPIFFEAuthHandler(t *testing.T) {
+	h := SPIFFEAuthHandler([]string{"spiffe://cluster.local/ns/*/sa/titan"})(okHandle)
+
+	tests := []struct {
+		uri  string
+		want int
+	}{
+		{"spiffe://cluster.local/ns/shared/sa/titan", http.StatusOK},
+		{"spiffe://cluster.local/ns/shared/sa/other", http.StatusForbidden},
+		{"spiffe://other.local/ns/shared/sa/titan", http.StatusForbidden},
+		{"spiffe://cluster.local:8443/ns/shared/sa/titan", http.StatusForbidden},
+		{"https://cluster.local/ns/shared/sa/titan", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		cert := &x509.Certificate{URIs: []*url.URL{mustParseURL(t, tt.uri)}}
+		w := serveWithCert(h, cert)
+		if w.Code != tt.want {
+			t.Errorf("%s: want %d response code, got: %d", tt.uri, tt.want, w.Code)
+		}
+	}
+}
+
+func TestNewAuthPolicyInvalidSPIFFEPattern(t *testing.T) {
+	_, err := NewAuthPolicy([]PolicyRule{
+		{Path: "/v1/*", AllowedSPIFFEIDs: []string{"cluster.local/ns/*/sa/titan"}},
+	})
+	if err == nil {
+		t.Fatal("expected an error for a SPIFFE ID pattern without the spiffe scheme")
+	}
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pantheon-systems/go-demo-service/pkg/appmetrics"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// serverMetricsPrefix prefixes the request metrics of the server.
+const serverMetricsPrefix = "http"
+
+// routeMetrics holds the metrics of a route, published under
+// `http.request.` and tagged with the method and route pattern:
+//   - success, failed, timer: the MethodMetrics, 5xx responses fail.
+//   - responses: counters of the responses, also tagged by status class.
+//   - in_flight: gauge of the requests being served.
+//   - request_size, response_size: histograms of the body sizes in bytes.
+//   - auth_denied: counter of the 401 and 403 responses.
+//   - panics: counter of the panics recovered by RecoveryHandler.
+//
+// The server totals are published under `http.server.` as ServerMetrics,
+// a session being a request.
+type routeMetrics struct {
+	*appmetrics.MethodMetrics
+	server       *appmetrics.ServerMetrics
+	statusClass  [5]metrics.Counter
+	inFlight     metrics.Gauge
+	inFlightN    int64
+	requestSize  metrics.Histogram
+	responseSize metrics.Histogram
+	authDenied   metrics.Counter
+}
+
+func newRouteMetrics(server *appmetrics.ServerMetrics, method, path string) *routeMetrics {
+	name := serverMetricsPrefix + ".request"
+	tags := appmetrics.Tags{"method": method, "route": path}
+	m := &routeMetrics{
+		MethodMetrics: appmetrics.NewMethodMetrics(name, tags),
+		server:        server,
+		inFlight:      appmetrics.GetOrRegisterGauge(name+".in_flight", tags, nil),
+		requestSize:   appmetrics.GetOrRegisterHistogram(name+".request_size", tags, nil),
+		responseSize:  appmetrics.GetOrRegisterHistogram(name+".response_size", tags, nil),
+		authDenied:    appmetrics.GetOrRegisterCounter(name+".auth_denied", tags, nil),
+	}
+	for i := range m.statusClass {
+		classTags := appmetrics.Tags{"method": method, "route": path, "class": fmt.Sprintf("%dxx", i+1)}
+		m.statusClass[i] = appmetrics.GetOrRegisterCounter(name+".responses", classTags, nil)
+	}
+	return m
+}
+
+// MetricsHandler records the request metrics of the route registered with
+// method and path. The route pattern rather than the request path keys the
+// metrics, which keeps their number bounded. It should wrap the auth
+// handlers to count the denied requests.
+func MetricsHandler(server *appmetrics.ServerMetrics, method, path string, h httprouter.Handle) httprouter.Handle {
+	m := newRouteMetrics(server, method, path)
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		m.inFlight.Update(atomic.AddInt64(&m.inFlightN, 1))
+		defer func() { m.inFlight.Update(atomic.AddInt64(&m.inFlightN, -1)) }()
+
+		start := time.Now()
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil && r.ContentLength < 0 {
+			r.Body = body
+		}
+		sw := &statusWriter{ResponseWriter: w}
+		h(sw, r, ps)
+		m.record(sw.status(), requestSize(r, body), sw.n, time.Since(start))
+	}
+}
+
+// requestSize returns the Content-Length of r when it is known. The size of
+// the bodies of unknown length, e.g. chunked, is the number of bytes the
+// handler read.
+func requestSize(r *http.Request, body *countingReader) int64 {
+	if r.ContentLength >= 0 {
+		return r.ContentLength
+	}
+	return body.n
+}
+
+func (m *routeMetrics) record(status int, requestSize, responseSize int64, elapsed time.Duration) {
+	m.Timer.Update(elapsed)
+	m.server.Sessions.Inc(1)
+	m.server.ConnectedTime.Update(elapsed)
+	if class := status / 100; class >= 1 && class <= 5 {
+		m.statusClass[class-1].Inc(1)
+	}
+	if status >= http.StatusInternalServerError {
+		m.Fail.Inc(1)
+		m.server.FailedSession.Inc(1)
+	} else {
+		m.Success.Inc(1)
+	}
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		m.authDenied.Inc(1)
+	}
+	m.requestSize.Update(requestSize)
+	m.responseSize.Update(responseSize)
+}
+
+// statusWriter records the status code and the body size of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+	n    int64
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.n += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher if the wrapped writer does. Flushing sends
+// the headers, with a 200 if none was written.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.code == 0 {
+			w.code = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// status returns the response status, 200 if the handler wrote nothing.
+func (w *statusWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pantheon-systems/go-demo-service/pkg/appmetrics"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+func counterValue(name string) int64 {
+	if c, ok := metrics.DefaultRegistry.Get(name).(metrics.Counter); ok {
+		return c.Count()
+	}
+	return 0
+}
+
+func TestMetricsHandler(t *testing.T) {
+	policy, err := NewAuthPolicy([]PolicyRule{
+		{Path: "/v1/*", AllowedOUs: []string{"titan"}},
+		{Path: "/v1/*/*", AllowedOUs: []string{"titan"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := New(Config{AuthResolver: policy.Resolve})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, err := server.GetRouter(policy.Resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{
+		"http.request.success;method=POST;route=/v1/demo-post",
+		"http.request.responses;class=2xx;method=POST;route=/v1/demo-post",
+		"http.request.responses;class=4xx;method=POST;route=/v1/demo-post",
+		"http.request.auth_denied;method=POST;route=/v1/demo-post",
+		"http.server.sessions",
+	}
+	before := map[string]int64{}
+	for _, name := range names {
+		before[name] = counterValue(name)
+	}
+
+	for _, ou := range []string{"titan", "titan", "site"} {
+		cert := &x509.Certificate{Subject: pkix.Name{OrganizationalUnit: []string{ou}}}
+		r, _ := http.NewRequest("POST", "/v1/demo-post", strings.NewReader("hello"))
+		r.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	want := []int64{3, 2, 1, 1, 3}
+	for i, name := range names {
+		if got := counterValue(name) - before[name]; got != want[i] {
+			t.Errorf("%s: want %d, got %d", name, want[i], got)
+		}
+	}
+	timer := metrics.DefaultRegistry.Get("http.request.timer;method=POST;route=/v1/demo-post").(metrics.Timer)
+	if timer.Count() < 3 {
+		t.Errorf("want the timer to record the requests, got %d", timer.Count())
+	}
+	responseSize := metrics.DefaultRegistry.Get("http.request.response_size;method=POST;route=/v1/demo-post").(metrics.Histogram)
+	if responseSize.Max() == 0 {
+		t.Error("want the response sizes to be recorded")
+	}
+	// DemoFunc does not read the body, its size is the Content-Length.
+	requestSize := metrics.DefaultRegistry.Get("http.request.request_size;method=POST;route=/v1/demo-post").(metrics.Histogram)
+	if requestSize.Max() != int64(len("hello")) {
+		t.Errorf("want the request sizes to be recorded, got max %d", requestSize.Max())
+	}
+	if metrics.DefaultRegistry.Get("http.request.in_flight;method=GET;route=/v1/healthz") == nil {
+		t.Error("want an in-flight gauge per route")
+	}
+}
+
+func TestMetricsHandlerChunkedRequestSize(t *testing.T) {
+	server := appmetrics.NewServerMetrics("test.chunked.server")
+	h := MetricsHandler(server, "POST", "/v1/chunked", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ioutil.ReadAll(r.Body)
+	})
+	r := httptest.NewRequest("POST", "/v1/chunked", strings.NewReader("chunked body"))
+	r.ContentLength = -1
+	h(httptest.NewRecorder(), r, nil)
+
+	requestSize := metrics.DefaultRegistry.Get("http.request.request_size;method=POST;route=/v1/chunked").(metrics.Histogram)
+	if requestSize.Max() != int64(len("chunked body")) {
+		t.Errorf("want the bytes read from a body of unknown length, got %d", requestSize.Max())
+	}
+}
+
+func TestStatusWriter(t *testing.T) {
+	w := &statusWriter{ResponseWriter: httptest.NewRecorder()}
+	if w.status() != http.StatusOK {
+		t.Fatalf("want 200 before anything is written, got %d", w.status())
+	}
+	w.WriteHeader(http.StatusNotFound)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("missing"))
+	if w.status() != http.StatusNotFound || w.n != 7 {
+		t.Fatalf("want the first status and the body size, got %d and %d", w.status(), w.n)
+	}
+}
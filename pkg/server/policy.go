@@ -0,0 +1,189 @@
+package server
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	certauth "github.com/pantheon-systems/go-certauth"
+)
+
+// PolicyRule grants access to the routes matching Methods and Path. A client
+// is allowed when its verified certificate matches every non-empty list of
+// the rule.
+type PolicyRule struct {
+	// Name identifies the rule in logs and error messages.
+	Name string `mapstructure:"name"`
+	// Methods the rule applies to. Empty matches every method.
+	Methods []string `mapstructure:"methods"`
+	// Path is a path.Match pattern matched against the route pattern, e.g.
+	// "/v1/sites/*" matches the route "/v1/sites/:site_id".
+	Path string `mapstructure:"path"`
+
+	AllowedOUs  []string `mapstructure:"allowed-ous"`
+	AllowedCNs  []string `mapstructure:"allowed-cns"`
+	AllowedSANs []string `mapstructure:"allowed-sans"`
+	// AllowedSPIFFEIDs are path.Match patterns matched against the SPIFFE ID
+	// URI SAN, e.g. "spiffe://cluster.local/ns/*/sa/titan".
+	AllowedSPIFFEIDs []string `mapstructure:"allowed-spiffe-ids"`
+}
+
+// AuthResolver returns the HandlerWrapper guarding the route registered for
+// method and path.
+type AuthResolver func(method, path string) (HandlerWrapper, error)
+
+// AuthPolicy is an ordered list of rules. The first rule matching a route
+// guards it.
+type AuthPolicy struct {
+	rules    []PolicyRule
+	wrappers []HandlerWrapper
+}
+
+// NewAuthPolicy validates the rules and compiles them into HandlerWrappers.
+func NewAuthPolicy(rules []PolicyRule) (*AuthPolicy, error) {
+	p := &AuthPolicy{}
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("#%d", i)
+		}
+		if rule.Path == "" {
+			return nil, fmt.Errorf("auth policy rule %s: path is required", rule.Name)
+		}
+		if _, err := path.Match(rule.Path, ""); err != nil {
+			return nil, fmt.Errorf("auth policy rule %s: invalid path pattern %q: %s", rule.Name, rule.Path, err)
+		}
+		if len(rule.AllowedOUs) == 0 && len(rule.AllowedCNs) == 0 && len(rule.AllowedSANs) == 0 && len(rule.AllowedSPIFFEIDs) == 0 {
+			return nil, fmt.Errorf("auth policy rule %s: at least one of allowed-ous, allowed-cns, allowed-sans or allowed-spiffe-ids is required", rule.Name)
+		}
+		for _, pattern := range rule.AllowedSPIFFEIDs {
+			if err := validSPIFFEPattern(pattern); err != nil {
+				return nil, fmt.Errorf("auth policy rule %s: %s", rule.Name, err)
+			}
+		}
+		for j, m := range rule.Methods {
+			rule.Methods[j] = strings.ToUpper(m)
+		}
+		p.rules = append(p.rules, rule)
+		p.wrappers = append(p.wrappers, compileRule(rule))
+	}
+	return p, nil
+}
+
+// Resolve implements AuthResolver. It returns an error when no rule matches,
+// so that a route can never be registered without authorization.
+func (p *AuthPolicy) Resolve(method, route string) (HandlerWrapper, error) {
+	for i, rule := range p.rules {
+		if rule.matches(method, route) {
+			log.Debugf("auth policy rule %s guards %s %s", rule.Name, method, route)
+			return p.wrappers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no auth policy rule matches route %s %s", method, route)
+}
+
+func (r PolicyRule) matches(method, route string) bool {
+	if len(r.Methods) > 0 {
+		found := false
+		for _, m := range r.Methods {
+			if m == method {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	ok, _ := path.Match(r.Path, route)
+	return ok
+}
+
+func compileRule(rule PolicyRule) HandlerWrapper {
+	var wrappers []HandlerWrapper
+	if len(rule.AllowedOUs) > 0 || len(rule.AllowedCNs) > 0 {
+		auth := certauth.NewAuth(certauth.Options{
+			AllowedOUs: rule.AllowedOUs,
+			AllowedCNs: rule.AllowedCNs,
+			// Denials are written as the JSON error response.
+			AuthErrorHandler: AuthFailed,
+		})
+		wrappers = append(wrappers, certAuthHandler(auth))
+	}
+	if len(rule.AllowedSANs) > 0 {
+		wrappers = append(wrappers, sanAuthHandler(rule.AllowedSANs))
+	}
+	if len(rule.AllowedSPIFFEIDs) > 0 {
+		wrappers = append(wrappers, SPIFFEAuthHandler(rule.AllowedSPIFFEIDs))
+	}
+	return func(h httprouter.Handle) httprouter.Handle {
+		// Wrap in reverse so the checks run in the order they were added.
+		for i := len(wrappers) - 1; i >= 0; i-- {
+			h = wrappers[i](h)
+		}
+		return h
+	}
+}
+
+// certAuthHandler checks the OUs and CNs with auth. Unlike auth.RouterHandler,
+// it also responds to requests without a verified certificate, which certauth
+// rejects without writing a response.
+func certAuthHandler(auth *certauth.Auth) HandlerWrapper {
+	return func(h httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			if err := auth.ValidateRequest(r); err != nil {
+				log.Debugf("cert auth failed: %s", err)
+				AuthFailed(w, r)
+				return
+			}
+			// Process writes the denials with the AuthErrorHandler.
+			if err := auth.Process(w, r); err != nil {
+				log.Debug(err)
+				return
+			}
+			h(w, r, ps)
+		}
+	}
+}
+
+// sanAuthHandler allows clients whose verified certificate carries one of the
+// allowed DNS, URI, email or IP subject alternative names.
+func sanAuthHandler(allowed []string) HandlerWrapper {
+	return func(h httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+				AuthFailed(w, r)
+				return
+			}
+			leaf := r.TLS.VerifiedChains[0][0]
+			if !hasAllowedSAN(leaf, allowed) {
+				log.Debugf("cert failed SAN validation, allowed: %v", allowed)
+				AuthFailed(w, r)
+				return
+			}
+			h(w, r, ps)
+		}
+	}
+}
+
+func hasAllowedSAN(cert *x509.Certificate, allowed []string) bool {
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	for _, a := range allowed {
+		for _, san := range sans {
+			if a == san {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestAuthPolicyResolve(t *testing.T) {
+	policy, err := NewAuthPolicy([]PolicyRule{
+		{
+			Name:       "admin",
+			Methods:    []string{"get"},
+			Path:       "/v1/demo-*",
+			AllowedOUs: []string{"titan"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrapper, err := policy.Resolve(http.MethodGet, "/v1/demo-get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := wrapper(okHandle)
+
+	w := serveWithCert(h, &x509.Certificate{Subject: pkix.Name{OrganizationalUnit: []string{"titan"}}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("want 200 response code for allowed OU, got: %d", w.Code)
+	}
+	w = serveWithCert(h, &x509.Certificate{Subject: pkix.Name{OrganizationalUnit: []string{"site"}}})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("want 403 response code for denied OU, got: %d", w.Code)
+	}
+
+	_, err = policy.Resolve(http.MethodPost, "/v1/demo-post")
+	if err == nil {
+		t.Fatal("expected an error for a route without a matching rule")
+	}
+}
+
+func TestAuthPolicySANs(t *testing.T) {
+	policy, err := NewAuthPolicy([]PolicyRule{
+		{
+			Path:        "/v1/*",
+			AllowedSANs: []string{"127.0.0.1", "client.example.com"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapper, err := policy.Resolve(http.MethodGet, "/v1/demo-get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := wrapper(okHandle)
+
+	w := serveWithCert(h, &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("127.0.0.1")}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("want 200 response code for allowed IP SAN, got: %d", w.Code)
+	}
+	w = serveWithCert(h, &x509.Certificate{DNSNames: []string{"client.example.com"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("want 200 response code for allowed DNS SAN, got: %d", w.Code)
+	}
+	w = serveWithCert(h, &x509.Certificate{DNSNames: []string{"other.example.com"}})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("want 403 response code for denied SAN, got: %d", w.Code)
+	}
+}
+
+func TestNewAuthPolicyInvalid(t *testing.T) {
+	invalid := []PolicyRule{
+		{Name: "no-path", AllowedOUs: []string{"titan"}},
+		{Name: "bad-pattern", Path: "/v1/[", AllowedOUs: []string{"titan"}},
+		{Name: "no-identities", Path: "/v1/*"},
+	}
+	for _, rule := range invalid {
+		if _, err := NewAuthPolicy([]PolicyRule{rule}); err == nil {
+			t.Errorf("expected an error for rule %s", rule.Name)
+		}
+	}
+}
+
+func TestGetRouterUnmatchedRoute(t *testing.T) {
+	policy, err := NewAuthPolicy([]PolicyRule{
+		{Path: "/v1/demo-get", AllowedOUs: []string{"titan"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = New(Config{AuthResolver: policy.Resolve})
+	if err == nil {
+		t.Fatal("expected an error when a route has no matching policy")
+	}
+}
+
+func okHandle(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func serveWithCert(h httprouter.Handle, cert *x509.Certificate) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	w := httptest.NewRecorder()
+	h(w, r, nil)
+	return w
+}
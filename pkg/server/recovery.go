@@ -0,0 +1,65 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pantheon-systems/go-demo-service/pkg/appmetrics"
+)
+
+// RecoveryHandler recovers the panics of the route registered with method
+// and path. The panic is logged with its stack, counted in
+// `http.request.panics` and sent to the App's Notifier, and the client gets
+// a 500 error response unless the response had started. It should be wrapped
+// by the access log, tracing and metrics handlers so that they record the
+// 500.
+func (s *Server) RecoveryHandler(method, path string, h httprouter.Handle) httprouter.Handle {
+	tags := appmetrics.Tags{"method": method, "route": path}
+	panics := appmetrics.GetOrRegisterCounter(serverMetricsPrefix+".request.panics", tags, nil)
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			if v := recover(); v != nil {
+				panics.Inc(1)
+				s.handlePanic(sw, r, v)
+			}
+		}()
+		h(sw, r, ps)
+	}
+}
+
+// handlePanic responds to a recovered panic. It is also the router's
+// PanicHandler, for the panics outside of the route handlers.
+func (s *Server) handlePanic(w http.ResponseWriter, r *http.Request, v interface{}) {
+	// net/http aborts the response silently on ErrAbortHandler.
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+	stack := string(debug.Stack())
+	LoggerFromContext(r.Context()).
+		WithField("severity", "critical").
+		WithField("stack", stack).
+		Error("runtime panic: ", v)
+	s.App.NotifyCritical(fmt.Sprintf("Application panic in %s %s: %v", r.Method, r.URL.Path, v))
+
+	// An error response would be appended to the partial response.
+	if sw, ok := w.(*statusWriter); ok && sw.code != 0 {
+		return
+	}
+	var debugTrace string
+	if s.Debug {
+		debugTrace = fmt.Sprintf("panic: %v\n%s", v, stack)
+	}
+	writeErrorResponse(w, r, &Error{Status: http.StatusInternalServerError, Code: CodeInternal}, debugTrace)
+}
+
+// panicHandler counts the panics recovered by the router.
+func (s *Server) panicHandler() func(http.ResponseWriter, *http.Request, interface{}) {
+	panics := appmetrics.GetOrRegisterCounter(serverMetricsPrefix+".server.panics", nil, nil)
+	return func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		panics.Inc(1)
+		s.handlePanic(w, r, v)
+	}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pantheon-systems/go-demo-service/pkg/app"
+	"github.com/pantheon-systems/go-demo-service/pkg/appmetrics"
+)
+
+func TestRecoveryHandler(t *testing.T) {
+	buf, restore := captureLog()
+	defer restore()
+
+	notifications := make(chan string, 1)
+	s := &Server{
+		App: &app.App{Notifier: app.NotifierFunc(func(ctx context.Context, message string) error {
+			notifications <- message
+			return nil
+		})},
+	}
+	h := AccessLogHandler("GET", "/v1/panic", s.RecoveryHandler("GET", "/v1/panic", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		panic("boom")
+	}))
+	panics := appmetrics.TaggedName(serverMetricsPrefix+".request.panics", appmetrics.Tags{"method": "GET", "route": "/v1/panic"})
+	before := counterValue(panics)
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", "/v1/panic", nil), nil)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+	body := decodeError(t, w)
+	if body.Code != CodeInternal || body.DebugTrace != "" {
+		t.Errorf("expected an internal error without debug trace, got %+v", body)
+	}
+	if got := counterValue(panics) - before; got != 1 {
+		t.Errorf("expected the panic to be counted, got %d", got)
+	}
+	logs := buf.String()
+	if !strings.Contains(logs, "runtime panic: boom") || !strings.Contains(logs, `"stack"`) || !strings.Contains(logs, body.RequestID) {
+		t.Errorf("expected the panic logged with its stack and request ID, got %s", logs)
+	}
+	if !strings.Contains(logs, `"status":500`) {
+		t.Errorf("expected the access log to record the 500, got %s", logs)
+	}
+	select {
+	case message := <-notifications:
+		if !strings.Contains(message, "boom") {
+			t.Errorf("expected the panic in the notification, got %q", message)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected a critical notification")
+	}
+}
+
+func TestRecoveryHandlerDebug(t *testing.T) {
+	_, restore := captureLog()
+	defer restore()
+
+	// No App: the panic is not notified.
+	s := &Server{Debug: true}
+	h := s.RecoveryHandler("GET", "/v1/panic", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		panic("boom")
+	})
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", "/v1/panic", nil), nil)
+
+	body := decodeError(t, w)
+	if !strings.HasPrefix(body.DebugTrace, "panic: boom\n") || !strings.Contains(body.DebugTrace, "goroutine") {
+		t.Errorf("expected the panic and its stack in the debug trace, got %q", body.DebugTrace)
+	}
+}
+
+func TestRecoveryHandlerResponseStarted(t *testing.T) {
+	buf, restore := captureLog()
+	defer restore()
+
+	notifications := make(chan string, 1)
+	s := &Server{
+		App: &app.App{Notifier: app.NotifierFunc(func(ctx context.Context, message string) error {
+			notifications <- message
+			return nil
+		})},
+	}
+	h := s.RecoveryHandler("GET", "/v1/panic", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.Write([]byte("partial"))
+		panic("boom")
+	})
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", "/v1/panic", nil), nil)
+
+	if w.Code != http.StatusOK || w.Body.String() != "partial" {
+		t.Errorf("expected the started response to be left as is, got %d %q", w.Code, w.Body)
+	}
+	if !strings.Contains(buf.String(), "runtime panic: boom") {
+		t.Errorf("expected the panic logged, got %s", buf)
+	}
+	select {
+	case <-notifications:
+	case <-time.After(time.Second):
+		t.Error("expected a critical notification")
+	}
+}
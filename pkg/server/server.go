@@ -2,17 +2,19 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
-	"fmt"
 	stdLibLog "log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
-	"github.com/pantheon-systems/certinel"
 	"github.com/pantheon-systems/go-certauth/certutils"
 	"github.com/pantheon-systems/go-demo-service/pkg/app"
+	"github.com/pantheon-systems/go-demo-service/pkg/appmetrics"
+	"github.com/pantheon-systems/go-demo-service/pkg/healthz"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -27,6 +29,18 @@ const (
 	MaxHeaderBytes = 1 << 20
 )
 
+// CertWatcher provides the hot reloaded server certificate.
+type CertWatcher interface {
+	GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	Close() error
+}
+
+// CAWatcher provides the hot reloaded client CA pool.
+type CAWatcher interface {
+	CertPool() *x509.CertPool
+	Close() error
+}
+
 // HandlerWrapper type allows us to bypass the clientauth in unit testing.
 type HandlerWrapper func(h httprouter.Handle) httprouter.Handle
 
@@ -39,9 +53,13 @@ type Config struct {
 	CACertPool       *x509.CertPool
 	GetStatusTimeout time.Duration
 
-	AdminAuthHandler   HandlerWrapper
-	BindingAuthHandler HandlerWrapper
-	CertWatcher        *certinel.Certinel // hot reloads mTLS certificates.
+	AuthResolver AuthResolver // selects the auth wrapper for each route.
+	CertWatcher  CertWatcher  // hot reloads mTLS certificates.
+	CAWatcher    CAWatcher    // hot reloads the client CA pool, overrides CACertPool.
+
+	// Debug adds the internal error details and panic stacks to the error
+	// responses. Clients see them, so it is meant for development.
+	Debug bool
 }
 
 type Server struct {
@@ -51,30 +69,55 @@ type Server struct {
 	ServerKey        string
 	GetStatusTimeout time.Duration
 	HealthzHandler   func(http.ResponseWriter, *http.Request)
+	ReadinessHandler func(http.ResponseWriter, *http.Request)
+	LivenessHandler  func(http.ResponseWriter, *http.Request)
+	// Debug adds the internal error details to the error responses.
+	Debug bool
 
-	certWatcher *certinel.Certinel
+	certWatcher CertWatcher
+	caWatcher   CAWatcher
+
+	// tlsConfig caches the per-handshake TLS config built for a CA pool.
+	tlsConfigMu   sync.Mutex
+	tlsConfigPool *x509.CertPool
+	tlsConfig     *tls.Config
 }
 
-// ResponseBody defines how the site/zone failover response looks like.
+// ResponseBody defines how the error responses look like.
 type ResponseBody struct {
+	Code       string `json:"code"`
 	Message    string `json:"message,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
 	DebugTrace string `json:"debug_trace,omitempty"`
 }
 
+// route is an API endpoint registered on the router.
+type route struct {
+	method string
+	path   string
+	handle httprouter.Handle
+}
+
 // New server constructor.
-func New(config Config) *Server {
+func New(config Config) (*Server, error) {
 	s := &Server{
 		ServerCert:       config.ServerCert,
 		ServerKey:        config.ServerKey,
 		App:              config.App,
 		GetStatusTimeout: config.GetStatusTimeout,
 		certWatcher:      config.CertWatcher,
+		caWatcher:        config.CAWatcher,
+		Debug:            config.Debug,
+	}
+	router, err := s.GetRouter(config.AuthResolver)
+	if err != nil {
+		return nil, err
 	}
 	tlsConfig := certutils.TLSServerConfig{
 		CertPool:    config.CACertPool,
 		BindAddress: config.BindAddress,
 		Port:        config.Port,
-		Router:      s.GetRouter(config.AdminAuthHandler, config.BindingAuthHandler),
+		Router:      router,
 	}
 	server := certutils.NewTLSServer(tlsConfig)
 	server.MaxHeaderBytes = MaxHeaderBytes
@@ -82,24 +125,73 @@ func New(config Config) *Server {
 	server.ReadTimeout = 5 * time.Second
 	server.WriteTimeout = 60 * time.Second
 	server.IdleTimeout = 120 * time.Second
-	server.TLSConfig.GetCertificate = s.certWatcher.GetCertificate
+	if s.certWatcher != nil {
+		server.TLSConfig.GetCertificate = s.certWatcher.GetCertificate
+	}
+	if s.caWatcher != nil {
+		base := server.TLSConfig.Clone()
+		server.TLSConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return s.configForPool(base, s.caWatcher.CertPool()), nil
+		}
+	}
 	s.TLSServer = server
-	return s
+	return s, nil
 }
 
-// GetRouter defines the API routes.
-func (s *Server) GetRouter(adminAuthWrapper HandlerWrapper, bindingAuthWrapper HandlerWrapper) http.Handler {
+// configForPool returns a copy of base trusting the client CAs of pool. New
+// handshakes pick up a reloaded pool while existing connections keep theirs.
+func (s *Server) configForPool(base *tls.Config, pool *x509.CertPool) *tls.Config {
+	s.tlsConfigMu.Lock()
+	defer s.tlsConfigMu.Unlock()
+	if s.tlsConfig == nil || s.tlsConfigPool != pool {
+		c := base.Clone()
+		c.ClientCAs = pool
+		s.tlsConfig = c
+		s.tlsConfigPool = pool
+	}
+	return s.tlsConfig
+}
+
+// routes defines the API routes. Access to each route is decided by the
+// auth policy, not here. The `/verbose` variants of the health routes show
+// the check details, so the policy should restrict them to admins.
+func (s *Server) routes() []route {
+	return []route{
+		{http.MethodGet, "/v1/demo-get", s.DemoFunc},
+		{http.MethodPost, "/v1/demo-post", s.DemoFunc},
+		{http.MethodGet, "/v1/demo-less-priviledge", s.DemoFunc},
+		{http.MethodGet, "/v1/healthz", s.HealthzProxyHandler},
+		{http.MethodGet, "/v1/healthz/verbose", s.healthzProxy(&s.HealthzHandler, true)},
+		{http.MethodGet, "/v1/readyz", s.healthzProxy(&s.ReadinessHandler, false)},
+		{http.MethodGet, "/v1/readyz/verbose", s.healthzProxy(&s.ReadinessHandler, true)},
+		{http.MethodGet, "/v1/liveness", s.healthzProxy(&s.LivenessHandler, false)},
+		{http.MethodGet, "/v1/liveness/verbose", s.healthzProxy(&s.LivenessHandler, true)},
+	}
+}
+
+// GetRouter registers the API routes, each wrapped by the HandlerWrapper that
+// auth returns for it. It fails if any route has no auth wrapper.
+func (s *Server) GetRouter(auth AuthResolver) (http.Handler, error) {
+	if auth == nil {
+		return nil, errors.New("server: no AuthResolver configured")
+	}
 	router := httprouter.New()
 	router.NotFound = http.HandlerFunc(NotFound)
+	router.MethodNotAllowed = http.HandlerFunc(MethodNotAllowed)
+	router.PanicHandler = s.panicHandler()
 
-	// The following API endpoints require privileged access
-	router.GET("/v1/demo-get", adminAuthWrapper(s.DemoFunc))
-	router.POST("/v1/demo-post", adminAuthWrapper(s.DemoFunc))
-
-	// Site bindings can access these API endpoints
-	router.GET("/v1/demo-less-priviledge", bindingAuthWrapper(s.DemoFunc))
+	serverMetrics := appmetrics.NewServerMetrics(serverMetricsPrefix + ".server")
+	for _, rt := range s.routes() {
+		wrapper, err := auth(rt.method, rt.path)
+		if err != nil {
+			return nil, errors.Wrap(err, "server: unable to authorize route")
+		}
+		handle := s.RecoveryHandler(rt.method, rt.path, IdentityHandler(wrapper(rt.handle)))
+		handle = TracingHandler(rt.method, rt.path, AccessLogHandler(rt.method, rt.path, handle))
+		router.Handle(rt.method, rt.path, MetricsHandler(serverMetrics, rt.method, rt.path, handle))
+	}
 
-	return router
+	return router, nil
 }
 
 // ListenAndServe starts the server.
@@ -107,6 +199,12 @@ func (s *Server) ListenAndServe(ctx context.Context) error {
 	if s.HealthzHandler == nil {
 		return errors.New("server.HealthzHandler == nil, please add a handler")
 	}
+	if s.ReadinessHandler == nil {
+		return errors.New("server.ReadinessHandler == nil, please add a handler")
+	}
+	if s.LivenessHandler == nil {
+		return errors.New("server.LivenessHandler == nil, please add a handler")
+	}
 	w := log.Logger.Writer()
 	s.TLSServer.ErrorLog = stdLibLog.New(w, "", 0)
 
@@ -125,14 +223,20 @@ func (s *Server) ListenAndServe(ctx context.Context) error {
 	tlsCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 	err := s.TLSServer.Shutdown(tlsCtx)
-	s.certWatcher.Close()
+	if s.certWatcher != nil {
+		s.certWatcher.Close()
+	}
+	if s.caWatcher != nil {
+		s.caWatcher.Close()
+	}
 	log.Info("Server stopped")
 	return err
 }
 
 // DemoFunc handles GET /v1/sites/:site_id and retrieves a site.
 func (s *Server) DemoFunc(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	var log = log.WithField("func", "DemoFunc")
+	// The request logger carries the request ID and client identity.
+	var log = LoggerFromContext(r.Context()).WithField("func", "DemoFunc")
 	enc := json.NewEncoder(w)
 	response := struct {
 		Message string
@@ -146,15 +250,21 @@ func (s *Server) DemoFunc(w http.ResponseWriter, r *http.Request, ps httprouter.
 	}
 }
 
-// NotFound returns the default response for when routes are not found.
-func NotFound(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotFound)
-	fmt.Fprint(w, "The requested route does not exist.\n")
-}
-
 // HealthzProxyHandler is the handler for /v1/healthz
 func (s *Server) HealthzProxyHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	// We don't want to expose the non-TLS healthz endpoint on the internet, so
-	// this just wraps the function.
-	s.HealthzHandler(w, r)
+	s.healthzProxy(&s.HealthzHandler, false)(w, r, ps)
+}
+
+// healthzProxy serves a healthz handler on the TLS server. The handler is
+// read on each request, as it is set once the server is created. Unless
+// verbose, the check details are redacted from the response.
+func (s *Server) healthzProxy(handler *func(http.ResponseWriter, *http.Request), verbose bool) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		// We don't want to expose the non-TLS healthz endpoint on the
+		// internet, so this just wraps the function.
+		if !verbose {
+			r = r.WithContext(healthz.WithRedaction(r.Context()))
+		}
+		(*handler)(w, r)
+	}
 }
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/x509"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -11,11 +12,16 @@ import (
 
 func TestGetDemoPath(t *testing.T) {
 	serverConfig := Config{
-		AdminAuthHandler:   mockRouterHandler,
-		BindingAuthHandler: mockRouterHandler,
+		AuthResolver: mockAuthResolver,
+	}
+	server, err := New(serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, err := server.GetRouter(mockAuthResolver)
+	if err != nil {
+		t.Fatal(err)
 	}
-	server := New(serverConfig)
-	router := server.GetRouter(mockRouterHandler, mockRouterHandler)
 
 	r, _ := http.NewRequest("GET", "/v1/demo-get", nil)
 	w := httptest.NewRecorder()
@@ -30,6 +36,52 @@ func TestGetDemoPath(t *testing.T) {
 	}
 }
 
+func TestClientCAReload(t *testing.T) {
+	ca := &fakeCAWatcher{pool: x509.NewCertPool()}
+	server, err := New(Config{
+		AuthResolver: mockAuthResolver,
+		CAWatcher:    ca,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	getConfig := server.TLSServer.TLSConfig.GetConfigForClient
+
+	first, err := getConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ClientCAs != ca.pool {
+		t.Fatal("expected the handshake config to trust the current CA pool")
+	}
+	again, _ := getConfig(nil)
+	if again != first {
+		t.Fatal("expected the handshake config to be reused while the CA pool is unchanged")
+	}
+
+	ca.pool = x509.NewCertPool()
+	reloaded, _ := getConfig(nil)
+	if reloaded.ClientCAs != ca.pool {
+		t.Fatal("expected the handshake config to trust the reloaded CA pool")
+	}
+}
+
+type fakeCAWatcher struct {
+	pool *x509.CertPool
+}
+
+func (f *fakeCAWatcher) CertPool() *x509.CertPool {
+	return f.pool
+}
+
+func (f *fakeCAWatcher) Close() error {
+	return nil
+}
+
+func mockAuthResolver(method, path string) (HandlerWrapper, error) {
+	return mockRouterHandler, nil
+}
+
 func mockRouterHandler(h httprouter.Handle) httprouter.Handle {
 	return httprouter.Handle(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		// Always allow the request for testing purposes.
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pantheon-systems/go-demo-service/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span attributes of the client identity.
+const (
+	attrClientCN       = attribute.Key("client.cn")
+	attrClientOU       = attribute.Key("client.ou")
+	attrClientSPIFFEID = attribute.Key("client.spiffe_id")
+	attrAuthDenied     = attribute.Key("auth.denied")
+)
+
+// TracingHandler serves each request of the route registered with method
+// and path in a server span, continuing the trace of the W3C traceparent
+// header of the request. The span is named after the route pattern and
+// carries the identity of the client certificate.
+func TracingHandler(method, path string, h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer().Start(ctx, method+" "+path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(method),
+				semconv.HTTPRouteKey.String(path),
+				semconv.HTTPTargetKey.String(r.URL.RequestURI()),
+			),
+		)
+		defer span.End()
+		if id, err := IdentityFromRequest(r); err == nil {
+			span.SetAttributes(
+				attrClientCN.String(id.CommonName),
+				attrClientOU.StringSlice(id.OrganizationalUnits),
+				attrClientSPIFFEID.String(id.SPIFFEID),
+			)
+		}
+
+		sw := &statusWriter{ResponseWriter: w}
+		h(sw, r.WithContext(ctx), ps)
+
+		status := sw.status()
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+		if status == http.StatusUnauthorized || status == http.StatusForbidden {
+			span.SetAttributes(attrAuthDenied.Bool(true))
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pantheon-systems/go-demo-service/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingHandler(t *testing.T) {
+	// Installs the propagator, no endpoint is set so nothing is exported.
+	if _, err := tracing.Start(context.Background(), tracing.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	var handlerSpan trace.SpanContext
+	h := TracingHandler("GET", "/v1/demo/:id", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handlerSpan = trace.SpanContextFromContext(r.Context())
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	r := httptest.NewRequest("GET", "/v1/demo/1?q=x", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "client", OrganizationalUnit: []string{"site"}}}
+	r.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	h(httptest.NewRecorder(), r, nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /v1/demo/:id" {
+		t.Errorf("expected the span to be named after the route, got %q", span.Name())
+	}
+	if got := span.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("expected the span to continue the traceparent, got parent %s", got)
+	}
+	if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected the trace ID of the traceparent, got %s", got)
+	}
+	if handlerSpan.SpanID() != span.SpanContext().SpanID() {
+		t.Error("expected the handler context to carry the server span")
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("expected an error status on 503, got %v", span.Status().Code)
+	}
+
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if got := attrs["http.status_code"].AsInt64(); got != http.StatusServiceUnavailable {
+		t.Errorf("expected http.status_code 503, got %d", got)
+	}
+	if got := attrs["http.target"].AsString(); got != "/v1/demo/1?q=x" {
+		t.Errorf("expected http.target /v1/demo/1?q=x, got %q", got)
+	}
+	if got := attrs[attrClientCN].AsString(); got != "client" {
+		t.Errorf("expected client.cn client, got %q", got)
+	}
+}
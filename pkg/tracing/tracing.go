@@ -0,0 +1,116 @@
+// Package tracing sets up OpenTelemetry tracing: the spans are exported to
+// an OTLP/HTTP collector and the W3C trace context is propagated.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var log = logrus.WithField("component", "tracing")
+
+// InstrumentationName names the tracer of the service's own spans.
+const InstrumentationName = "github.com/pantheon-systems/go-demo-service"
+
+// Config configures the span exporter.
+type Config struct {
+	// Endpoint is the host:port of the OTLP/HTTP collector. Tracing is
+	// disabled when empty, the trace context is still propagated.
+	Endpoint string
+	// URLPath defaults to the collector's `/v1/traces`.
+	URLPath  string
+	Insecure bool
+	Headers  map[string]string
+	// SampleRatio is the ratio of the new traces sampled, the sampling
+	// decision of the caller is followed otherwise.
+	SampleRatio float64
+	ServiceName string
+	Version     string
+}
+
+// Start installs the global tracer provider and propagator. The returned
+// func flushes the pending spans and stops the exporter.
+func Start(ctx context.Context, config Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if config.Endpoint == "" {
+		log.Info("no tracing endpoint specified, not exporting spans")
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(config.Endpoint),
+		otlptracehttp.WithTimeout(10 * time.Second),
+	}
+	if config.URLPath != "" {
+		opts = append(opts, otlptracehttp.WithURLPath(config.URLPath))
+	}
+	if config.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if len(config.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(config.Headers))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the tracing exporter: %s", err)
+	}
+
+	res := resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(config.ServiceName),
+		semconv.ServiceVersionKey.String(config.Version),
+	)
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	log.Infof("exporting spans to %s, sampling %v of the new traces", config.Endpoint, config.SampleRatio)
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of the service's own spans.
+func Tracer() trace.Tracer {
+	return otel.Tracer(InstrumentationName)
+}
+
+// LogHook adds the trace and span IDs of the context of log entries, set
+// with WithContext, to their fields.
+type LogHook struct{}
+
+// Levels implements logrus.Hook.
+func (LogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook.
+func (LogHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	sc := trace.SpanContextFromContext(entry.Context)
+	if !sc.IsValid() {
+		return nil
+	}
+	// The Data of the entry is shared with the entry it derives from, so
+	// the IDs are added to a copy.
+	data := make(logrus.Fields, len(entry.Data)+2)
+	for k, v := range entry.Data {
+		data[k] = v
+	}
+	data["trace_id"] = sc.TraceID().String()
+	data["span_id"] = sc.SpanID().String()
+	entry.Data = data
+	return nil
+}
@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestStartDisabled(t *testing.T) {
+	shutdown, err := Start(context.Background(), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown: %s", err)
+	}
+}
+
+func TestStartExportsSpans(t *testing.T) {
+	requests := make(chan *http.Request, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	defer collector.Close()
+
+	shutdown, err := Start(context.Background(), Config{
+		Endpoint:    strings.TrimPrefix(collector.URL, "http://"),
+		Insecure:    true,
+		Headers:     map[string]string{"X-Test": "yes"},
+		SampleRatio: 1,
+		ServiceName: "test",
+		Version:     "v1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	_, span := Tracer().Start(context.Background(), "test")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %s", err)
+	}
+
+	select {
+	case r := <-requests:
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" {
+			t.Errorf("expected a POST to /v1/traces, got %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("X-Test"); got != "yes" {
+			t.Errorf("expected the configured headers, got X-Test: %q", got)
+		}
+	default:
+		t.Fatal("expected the span to be exported on shutdown")
+	}
+}
+
+func TestLogHook(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+
+	logger := logrus.New()
+	parent := logger.WithField("component", "test")
+	entry := parent.WithContext(ctx)
+	if err := (LogHook{}).Fire(entry); err != nil {
+		t.Fatal(err)
+	}
+	if got := entry.Data["trace_id"]; got != traceID.String() {
+		t.Errorf("expected trace_id %s, got %v", traceID, got)
+	}
+	if got := entry.Data["span_id"]; got != spanID.String() {
+		t.Errorf("expected span_id %s, got %v", spanID, got)
+	}
+	if _, ok := parent.Data["trace_id"]; ok {
+		t.Error("expected the fields of the parent entry to be left untouched")
+	}
+
+	entry = parent.WithContext(context.Background())
+	if err := (LogHook{}).Fire(entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entry.Data["trace_id"]; ok {
+		t.Error("expected no trace_id without a span context")
+	}
+}